@@ -0,0 +1,374 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build (darwin || freebsd || linux) && (amd64 || arm64)
+
+package purego_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+	"github.com/ebitengine/purego/internal/load"
+)
+
+func buildABITest(t *testing.T) uintptr {
+	libFileName := filepath.Join(t.TempDir(), "abitest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "abitest", "abi_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(libFileName) })
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+	return lib
+}
+
+func TestRegisterFunc_twoIntegerReturns(t *testing.T) {
+	lib := buildABITest(t)
+
+	const (
+		lo = 0xdeadbeefcafebabe
+		hi = 0x0123456789abcdef
+	)
+	{
+		var ReturnUint128 func(lo, hi uint64) (uint64, uint64)
+		purego.RegisterLibFunc(&ReturnUint128, lib, "ReturnUint128")
+		if gotLo, gotHi := ReturnUint128(lo, hi); gotLo != lo || gotHi != hi {
+			t.Errorf("ReturnUint128 returned %#x, %#x wanted %#x, %#x", gotLo, gotHi, uint64(lo), uint64(hi))
+		}
+	}
+	{
+		var ReturnTwoWords func(a, b uintptr) (uintptr, int64)
+		purego.RegisterLibFunc(&ReturnTwoWords, lib, "ReturnTwoWords")
+		if a, b := ReturnTwoWords(lo, 123); a != lo || b != 123 {
+			t.Errorf("ReturnTwoWords returned %#x, %d wanted %#x, %d", a, b, uint64(lo), 123)
+		}
+	}
+}
+
+func TestRegisterFunc_StructReturn(t *testing.T) {
+	lib := buildABITest(t)
+
+	type FourWords struct {
+		a, b, c, d int64
+	}
+	var ReturnFourWords func(a, b, c, d int64, ret purego.StructReturn)
+	purego.RegisterLibFunc(&ReturnFourWords, lib, "ReturnFourWords")
+	var got FourWords
+	ReturnFourWords(1, -2, 3, -4, purego.StructReturn(unsafe.Pointer(&got)))
+	if want := (FourWords{1, -2, 3, -4}); got != want {
+		t.Errorf("ReturnFourWords returned %+v wanted %+v", got, want)
+	}
+}
+
+func TestRegisterFunc_maxIntegerArguments(t *testing.T) {
+	lib := buildABITest(t)
+
+	{
+		var Sum14 func(a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14 int64) int64
+		purego.RegisterLibFunc(&Sum14, lib, "Sum14")
+		const expected = 1*1 + 2*2 + 3*3 + 4*4 + 5*5 + 6*6 + 7*7 + 8*8 + 9*9 + 10*10 + 11*11 + 12*12 + 13*13 + 14*14
+		if ret := Sum14(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14); ret != expected {
+			t.Errorf("Sum14 returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		var Sum15 func(a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14, a15 int64) int64
+		purego.RegisterLibFunc(&Sum15, lib, "Sum15")
+		const expected = 1*1 + 2*2 + 3*3 + 4*4 + 5*5 + 6*6 + 7*7 + 8*8 + 9*9 + 10*10 + 11*11 + 12*12 + 13*13 + 14*14 + 15*15
+		if ret := Sum15(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15); ret != expected {
+			t.Errorf("Sum15 returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		var SumVariadic func(a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14 int64, args ...any) int64
+		purego.RegisterLibFunc(&SumVariadic, lib, "Sum15")
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("calling SumVariadic with 16 arguments didn't panic")
+				}
+			}()
+			SumVariadic(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16)
+		}()
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("registering a function with 16 arguments didn't panic")
+			}
+		}()
+		var Sum16 func(a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14, a15, a16 int64) int64
+		purego.RegisterLibFunc(&Sum16, lib, "Sum15")
+	}()
+}
+
+func TestRegisterFunc_boolOnStack(t *testing.T) {
+	lib := buildABITest(t)
+
+	var BoolOnStack func(a1, a2, a3, a4, a5, a6, a7, a8 int64, b bool, a10 int64) int64
+	purego.RegisterLibFunc(&BoolOnStack, lib, "BoolOnStack")
+	const sum = 1*1 + 2*2 + 3*3 + 4*4 + 5*5 + 6*6 + 7*7 + 8*8 + 10*10
+	if got := BoolOnStack(1, 2, 3, 4, 5, 6, 7, 8, false, 10); got != sum {
+		t.Errorf("BoolOnStack(false) returned %d wanted %d", got, sum)
+	}
+	if got := BoolOnStack(1, 2, 3, 4, 5, 6, 7, 8, true, 10); got != -sum {
+		t.Errorf("BoolOnStack(true) returned %d wanted %d", got, -sum)
+	}
+}
+
+func TestRegisterFunc_carry(t *testing.T) {
+	lib := buildABITest(t)
+
+	var AddWithCarry func(a, b uint64) (uint64, purego.Carry)
+	purego.RegisterLibFunc(&AddWithCarry, lib, "AddWithCarry")
+	if sum, carry := AddWithCarry(1, 2); sum != 3 || carry {
+		t.Errorf("AddWithCarry(1, 2) returned %d, %t wanted %d, %t", sum, carry, 3, false)
+	}
+	if sum, carry := AddWithCarry(1<<63, 1<<63+5); sum != 5 || !carry {
+		t.Errorf("AddWithCarry(1<<63, 1<<63+5) returned %d, %t wanted %d, %t", sum, carry, 5, true)
+	}
+}
+
+func TestRegisterFuncOut(t *testing.T) {
+	lib := buildABITest(t)
+
+	var GetSize func(id int32) (ok bool, w, h int32)
+	purego.RegisterLibFuncOut(&GetSize, lib, "GetSize", 2)
+	if ok, w, h := GetSize(5); !ok || w != 10 || h != 15 {
+		t.Errorf("GetSize(5) returned %t, %d, %d wanted %t, %d, %d", ok, w, h, true, 10, 15)
+	}
+	if ok, _, _ := GetSize(-1); ok {
+		t.Errorf("GetSize(-1) returned %t wanted %t", ok, false)
+	}
+
+	var SplitWords func(x uint64) (lo, hi uint32)
+	purego.RegisterLibFuncOut(&SplitWords, lib, "SplitWords", 2)
+	if lo, hi := SplitWords(0x1234567890abcdef); lo != 0x90abcdef || hi != 0x12345678 {
+		t.Errorf("SplitWords returned %#x, %#x wanted %#x, %#x", lo, hi, 0x90abcdef, 0x12345678)
+	}
+}
+
+func TestRegisterFunc_sliceReturn(t *testing.T) {
+	lib := buildABITest(t)
+
+	var GetNumbers func(n int32) purego.CSlice[int32]
+	purego.RegisterLibFunc(&GetNumbers, lib, "GetNumbers")
+	if got, want := GetNumbers(5), (purego.CSlice[int32]{0, 1, 4, 9, 16}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetNumbers(5) returned %v wanted %v", got, want)
+	}
+	if got := GetNumbers(-1); got != nil {
+		t.Errorf("GetNumbers(-1) returned %v wanted nil", got)
+	}
+
+	// a plain slice doesn't get the hidden length parameter
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("registering a function that returns []int32 didn't panic")
+		}
+	}()
+	var GetNumbersSlice func(n int32) []int32
+	purego.RegisterLibFunc(&GetNumbersSlice, lib, "GetNumbers")
+}
+
+func TestRegisterFunc_StringArray(t *testing.T) {
+	lib := buildABITest(t)
+
+	var ArgvLength func(argv purego.StringArray) purego.Size
+	purego.RegisterLibFunc(&ArgvLength, lib, "ArgvLength")
+	if got := ArgvLength(purego.StringArray{"ls", "-l", "/tmp\x00"}); got != 3*1000+2+2+4 {
+		t.Errorf("ArgvLength returned %d wanted %d", got, 3*1000+2+2+4)
+	}
+	if got := ArgvLength(nil); got != 0 {
+		t.Errorf("ArgvLength(nil) returned %d wanted %d", got, 0)
+	}
+
+	var ArgvLengthPtr func(argv **byte) purego.Size
+	purego.RegisterLibFunc(&ArgvLengthPtr, lib, "ArgvLength")
+	argv, release := purego.CStringArray([]string{"ls", "-l", "/tmp"})
+	defer release()
+	if got := ArgvLengthPtr(argv); got != 3*1000+2+2+4 {
+		t.Errorf("ArgvLength of CStringArray returned %d wanted %d", got, 3*1000+2+2+4)
+	}
+}
+
+func TestRegisterFunc_StringArrayReturn(t *testing.T) {
+	lib := buildABITest(t)
+
+	want := []string{"purego", "", "calls C"}
+	var GetWords func() purego.StringArray
+	purego.RegisterLibFunc(&GetWords, lib, "GetWords")
+	if got := GetWords(); !reflect.DeepEqual([]string(got), want) {
+		t.Errorf("GetWords returned %q wanted %q", got, want)
+	}
+	var GetWordsPtr func() uintptr
+	purego.RegisterLibFunc(&GetWordsPtr, lib, "GetWords")
+	if got := purego.GoStrings(GetWordsPtr()); !reflect.DeepEqual(got, want) {
+		t.Errorf("GoStrings returned %q wanted %q", got, want)
+	}
+	if got := purego.GoStrings(0); got != nil {
+		t.Errorf("GoStrings(0) returned %q wanted nil", got)
+	}
+}
+
+func TestRegisterFunc_twoRegisterReturns_ldiv(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	// ldiv_t ldiv(long numer, long denom); returns {quot, rem} in two registers
+	var ldiv func(numer, denom int64) (quot, rem int64)
+	purego.RegisterLibFunc(&ldiv, libc, "ldiv")
+	if quot, rem := ldiv(-17, 5); quot != -3 || rem != -2 {
+		t.Errorf("ldiv returned %d, %d wanted %d, %d", quot, rem, -3, -2)
+	}
+}
+
+// namedPointer is a pointer type of its own like the type of a handle to an opaque C struct.
+type namedPointer *int64
+
+func TestClassifyStruct(t *testing.T) {
+	if runtime.GOOS == "freebsd" || runtime.GOOS == "linux" && runtime.GOARCH == "arm64" {
+		t.Skip("struct arguments are only supported on darwin amd64 & arm64 and linux amd64")
+	}
+	const (
+		I = purego.ArgInteger
+		F = purego.ArgFloat
+		S = purego.ArgStack
+		R = purego.ArgReference
+	)
+	for _, test := range []struct {
+		name  string
+		typ   reflect.Type
+		amd64 []purego.ArgClass
+		arm64 []purego.ArgClass
+	}{
+		{"empty", reflect.TypeOf(struct{}{}), nil, nil},
+		{"float64 int64", reflect.TypeOf(struct {
+			X float64
+			Y int64
+		}{}), []purego.ArgClass{F, I}, []purego.ArgClass{I, I}},
+		{"two float32", reflect.TypeOf(struct{ A, B float32 }{}), []purego.ArgClass{F}, []purego.ArgClass{F, F}},
+		{"int32 float32", reflect.TypeOf(struct {
+			A int32
+			B float32
+		}{}), []purego.ArgClass{I}, []purego.ArgClass{I}},
+		{"four float64", reflect.TypeOf(struct{ A, B, C, D float64 }{}), []purego.ArgClass{S, S, S, S}, []purego.ArgClass{F, F, F, F}},
+		{"opaque 24 bytes", reflect.TypeOf(struct{ _ [24]byte }{}), []purego.ArgClass{S, S, S}, []purego.ArgClass{R}},
+		{"four float32", reflect.TypeOf(struct{ A, B, C, D float32 }{}), []purego.ArgClass{F, F}, []purego.ArgClass{F, F, F, F}},
+		{"five float64", reflect.TypeOf(struct{ A, B, C, D, E float64 }{}), []purego.ArgClass{S, S, S, S, S}, []purego.ArgClass{R}},
+		{"opaque 17 bytes", reflect.TypeOf(struct{ _ [17]byte }{}), []purego.ArgClass{S, S, S}, []purego.ArgClass{R}},
+		{"mixed 32 bytes", reflect.TypeOf(struct {
+			A int64
+			B float64
+			C int32
+			D float32
+			E int64
+		}{}), []purego.ArgClass{S, S, S, S}, []purego.ArgClass{R}},
+		{"two float32 int64", reflect.TypeOf(struct {
+			A, B float32
+			C    int64
+		}{}), []purego.ArgClass{F, I}, []purego.ArgClass{I, I}},
+		{"float32 int32 float64", reflect.TypeOf(struct {
+			A float32
+			B int32
+			C float64
+		}{}), []purego.ArgClass{I, F}, []purego.ArgClass{I, I}},
+		{"named pointer", reflect.TypeOf(struct{ P namedPointer }{}), []purego.ArgClass{I}, []purego.ArgClass{I}},
+		{"pointer int32", reflect.TypeOf(struct {
+			P *int64
+			N int32
+		}{}), []purego.ArgClass{I, I}, []purego.ArgClass{I, I}},
+		{"pointer float64", reflect.TypeOf(struct {
+			P unsafe.Pointer
+			F float64
+		}{}), []purego.ArgClass{I, F}, []purego.ArgClass{I, I}},
+		{"GUID", reflect.TypeOf(struct {
+			Data1        uint32
+			Data2, Data3 uint16
+			Data4        [8]byte
+		}{}), []purego.ArgClass{I, I}, []purego.ArgClass{I, I}},
+		{"opaque 72 bytes", reflect.TypeOf(struct{ _ [72]byte }{}), []purego.ArgClass{S, S, S, S, S, S, S, S, S}, []purego.ArgClass{R}},
+	} {
+		want := test.amd64
+		if runtime.GOARCH == "arm64" {
+			want = test.arm64
+		}
+		if got := purego.ClassifyStruct(test.typ); !reflect.DeepEqual(got, want) {
+			t.Errorf("ClassifyStruct(%s) returned %v wanted %v", test.name, got, want)
+		}
+	}
+}
+
+func TestClassifyStruct_embedded(t *testing.T) {
+	if runtime.GOOS == "freebsd" || runtime.GOOS == "linux" && runtime.GOARCH == "arm64" {
+		t.Skip("struct arguments are only supported on darwin amd64 & arm64 and linux amd64")
+	}
+	type base struct {
+		X float32
+		Y int32
+	}
+	type point struct{ X, Y float32 }
+	type small struct{ A int8 }
+	// each embedded struct is placed like the flattened struct with its fields written out in its place
+	for _, test := range []struct {
+		name      string
+		embedded  reflect.Type
+		flattened reflect.Type
+	}{
+		{"mixed", reflect.TypeOf(struct {
+			base
+			Z float64
+		}{}), reflect.TypeOf(struct {
+			X float32
+			Y int32
+			Z float64
+		}{})},
+		{"floats", reflect.TypeOf(struct {
+			point
+			Z float32
+		}{}), reflect.TypeOf(struct{ X, Y, Z float32 }{})},
+		{"twice", reflect.TypeOf(struct {
+			point
+			P point
+		}{}), reflect.TypeOf(struct{ X, Y, PX, PY float32 }{})},
+		{"bytes", reflect.TypeOf(struct {
+			small
+			B int8
+			C int16
+		}{}), reflect.TypeOf(struct {
+			A, B int8
+			C    int16
+		}{})},
+		{"large", reflect.TypeOf(struct {
+			base
+			W [4]float64
+		}{}), reflect.TypeOf(struct {
+			X float32
+			Y int32
+			W [4]float64
+		}{})},
+	} {
+		if test.embedded.Size() != test.flattened.Size() {
+			t.Fatalf("%s: the embedded struct has %d bytes and the flattened one %d", test.name, test.embedded.Size(), test.flattened.Size())
+		}
+		got, want := purego.ClassifyStruct(test.embedded), purego.ClassifyStruct(test.flattened)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ClassifyStruct(%s) returned %v for the embedded struct and %v for the flattened one", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// NewCallbackRecover is NewCallback for a fn that recovers from its own panics instead of letting them unwind into
+// the C code that called it, which crashes the process. After a panic, onPanic is called with the value that was
+// recovered, unless it's nil, and the callback returns the zero value of its result to C, so the result is best
+// chosen such that 0 means failure:
+//
+//	cb := purego.NewCallbackRecover(func(event *Event) int32 {
+//		handle(event) // may panic
+//		return 1
+//	}, func(v any) {
+//		log.Printf("event handler panicked: %v", v)
+//	})
+//
+// Recovering hides the bug that caused the panic and leaves the program in whatever state the panic left it in,
+// so only use it where crashing is worse, like a plugin that must not take down its host.
+func NewCallbackRecover(fn any, onPanic func(v any)) uintptr {
+	val := reflect.ValueOf(fn)
+	if val.Kind() != reflect.Func {
+		panic("purego: fn must be a function")
+	}
+	ty := val.Type()
+	return NewCallback(reflect.MakeFunc(ty, func(args []reflect.Value) (results []reflect.Value) {
+		defer func() {
+			if v := recover(); v != nil {
+				if onPanic != nil {
+					onPanic(v)
+				}
+				results = make([]reflect.Value, ty.NumOut())
+				for i := range results {
+					results[i] = reflect.Zero(ty.Out(i))
+				}
+			}
+		}()
+		return val.Call(args)
+	}).Interface())
+}
+
+// NewCallbackStruct returns a pointer to a C struct of function pointers, like a table of callbacks,
+// that has a field for each field of goStruct. Every field of goStruct must be a function, which is converted
+// with NewCallback and has the same restrictions, or nil, which becomes a NULL function pointer:
+//
+//	// struct allocator { void *(*alloc)(size_t); void (*free)(void *); };
+//	allocator := purego.NewCallbackStruct(struct {
+//		Alloc func(size purego.Size) unsafe.Pointer
+//		Free  func(ptr unsafe.Pointer)
+//	}{alloc, free})
+//
+// The struct is allocated in C memory and, like the callbacks, never released so it stays valid
+// for the lifetime of the process and can be kept by C code. It panics if goStruct isn't a struct of functions.
+func NewCallbackStruct(goStruct any) unsafe.Pointer {
+	v := reflect.ValueOf(goStruct)
+	if v.Kind() != reflect.Struct {
+		panic("purego: goStruct must be a struct but was " + v.Kind().String())
+	}
+	table := make([]uintptr, v.NumField())
+	for i := range table {
+		f := v.Field(i)
+		if f.Kind() != reflect.Func {
+			panic("purego: field " + v.Type().Field(i).Name + " must be a function but was " + f.Kind().String())
+		}
+		if f.IsNil() {
+			continue
+		}
+		if !v.Type().Field(i).IsExported() {
+			panic("purego: field " + v.Type().Field(i).Name + " must be exported")
+		}
+		table[i] = NewCallback(f.Interface())
+	}
+	if len(table) == 0 {
+		return nil
+	}
+	ptr := cMalloc(uintptr(len(table)) * unsafe.Sizeof(table[0]))
+	copy(unsafe.Slice((*uintptr)(ptr), len(table)), table)
+	return ptr
+}
@@ -8,8 +8,13 @@ package purego_test
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/ebitengine/purego"
@@ -50,6 +55,286 @@ func TestCallGoFromSharedLib(t *testing.T) {
 	}
 }
 
+// TestNewCallbackReentrant checks that a callback can call into C which calls the same callback again.
+func TestNewCallbackReentrant(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	type node struct {
+		value       int32
+		left, right *node
+	}
+	var getTree func() *node
+	purego.RegisterLibFunc(&getTree, lib, "getTree")
+	var walkTree func(fp uintptr, n *node, depth int32, scale float64) int32
+	purego.RegisterLibFunc(&walkTree, lib, "walkTree")
+
+	var visit uintptr
+	visit = purego.NewCallback(func(n *node, depth int32, scale float64) int32 {
+		sum := int32(float64(n.value)*scale) * depth
+		sum += walkTree(visit, n.left, depth+1, scale*2)
+		sum += walkTree(visit, n.right, depth+1, scale*2)
+		return sum
+	})
+
+	// 1*1*1 + (2+3)*2*2 + (4+5+6+7)*4*3
+	const want = 285
+	if got := walkTree(visit, getTree(), 1, 1); got != want {
+		t.Errorf("walkTree returned %d wanted %d", got, want)
+	}
+}
+
+func TestNewCallbackStruct(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var applyOperations func(ops unsafe.Pointer, a, b int32) int32
+	purego.RegisterLibFunc(&applyOperations, lib, "applyOperations")
+
+	type operations struct {
+		Add func(a, b int32) int32
+		Mul func(a, b int32) int32
+		Neg func(a int32) int32
+	}
+	add := func(a, b int32) int32 { return a + b }
+	mul := func(a, b int32) int32 { return a * b }
+	ops := purego.NewCallbackStruct(operations{Add: add, Mul: mul, Neg: func(a int32) int32 { return -a }})
+	if got := applyOperations(ops, 2, 3); got != -15 {
+		t.Errorf("applyOperations returned %d wanted %d", got, -15)
+	}
+	// a nil function is a NULL pointer
+	ops = purego.NewCallbackStruct(operations{Add: add, Mul: mul})
+	if got := applyOperations(ops, 2, 3); got != 15 {
+		t.Errorf("applyOperations returned %d wanted %d", got, 15)
+	}
+}
+
+// TestNewCallbackHandle checks that a Handle passed to C as the void* of a callback gives the Go value back to the callback.
+func TestNewCallbackHandle(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var forEachValue func(values []int32, n int32, fn uintptr, ctx purego.Handle)
+	purego.RegisterLibFunc(&forEachValue, lib, "forEachValue")
+
+	type summer struct {
+		sum   int32
+		count int
+	}
+	cb := purego.NewCallback(func(ctx purego.Handle, value int32) {
+		// the value stays valid even if the garbage collector runs while C has the handle
+		runtime.GC()
+		s := ctx.Value().(*summer)
+		s.sum += value
+		s.count++
+	})
+	h := purego.NewHandle(&summer{})
+	values := []int32{1, 2, 3, 4}
+	forEachValue(values, int32(len(values)), cb, h)
+	if s := h.Value().(*summer); s.sum != 10 || s.count != 4 {
+		t.Errorf("the callback summed %d values to %d wanted 4 values summed to 10", s.count, s.sum)
+	}
+
+	h.Delete()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Value of a deleted Handle didn't panic")
+		}
+	}()
+	h.Value()
+}
+
+// TestNewCallbackSignals checks that deep chains of C and Go calls aren't clobbered by the signals that arrive
+// while they run, which would happen if the trampolines left something in the red zone below the stack pointer.
+func TestNewCallbackSignals(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var deepCall func(depth int32, cb uintptr) int32
+	purego.RegisterLibFunc(&deepCall, lib, "deepCall")
+	cb := purego.NewCallback(func(depth int32) int32 {
+		// go back into C from the deepest frame
+		return deepCall(64, 0)
+	})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+			default:
+				_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	var calls sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			for i := 0; i < 200; i++ {
+				if got := deepCall(64, cb); got != 130 {
+					t.Errorf("deepCall returned %d wanted 130", got)
+					return
+				}
+			}
+		}()
+	}
+	calls.Wait()
+}
+
+func TestCallbackToChannel(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var notifyAsync func(fn uintptr, n int32) int32
+	purego.RegisterLibFunc(&notifyAsync, lib, "notifyAsync")
+
+	// the channel isn't buffered so the C thread waits for each value to be received
+	ch := make(chan int32)
+	if ret := notifyAsync(purego.CallbackToChannel[int32](ch), 5); ret != 0 {
+		t.Fatalf("notifyAsync returned %d wanted 0", ret)
+	}
+	for want := int32(0); want < 5; want++ {
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Errorf("received %d wanted %d", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("the callback never sent %d", want)
+		}
+	}
+}
+
+func TestNewCallbackTable(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var dispatch func(handlers []uintptr, n int32, event int32) int32
+	purego.RegisterLibFunc(&dispatch, lib, "dispatch")
+	handlers := []uintptr{
+		purego.NewCallback(func(event int32) int32 { return event }),
+		purego.NewCallback(func(event int32) int32 {
+			// the table stays alive while the C function that it was passed to runs
+			runtime.GC()
+			return 10 * event
+		}),
+		purego.NewCallback(func(event int32) int32 { return 100 * event }),
+	}
+	if got := dispatch(handlers, int32(len(handlers)), 2); got != 222 {
+		t.Errorf("dispatch returned %d wanted %d", got, 222)
+	}
+}
+
+func TestNewCallbackRecover(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var dispatch func(handlers []uintptr, n int32, event int32) int32
+	purego.RegisterLibFunc(&dispatch, lib, "dispatch")
+	var recovered any
+	handlers := []uintptr{
+		purego.NewCallback(func(event int32) int32 { return event }),
+		purego.NewCallbackRecover(func(event int32) int32 {
+			panic("handler failed")
+		}, func(v any) {
+			recovered = v
+		}),
+		purego.NewCallbackRecover(func(event int32) int32 { return 100 * event }, nil),
+	}
+	// the handler that panicked returns 0 and the others still run
+	if got := dispatch(handlers, int32(len(handlers)), 2); got != 202 {
+		t.Errorf("dispatch returned %d wanted %d", got, 202)
+	}
+	if recovered != "handler failed" {
+		t.Errorf("onPanic got %v wanted %q", recovered, "handler failed")
+	}
+}
+
 func TestNewCallbackFloat64(t *testing.T) {
 	// This tests the maximum number of arguments a function to NewCallback can take
 	const (
@@ -173,3 +458,90 @@ func ExampleNewCallback_cdecl() {
 
 	// Output: 83
 }
+
+func TestAttachFinalizer(t *testing.T) {
+	freed := make(chan uintptr, 2)
+	freeFn := purego.NewCallback(func(ptr uintptr) {
+		freed <- ptr
+	})
+	objects := make([]byte, 2)
+
+	// Free frees the object once and right away
+	obj := purego.AttachFinalizer(unsafe.Pointer(&objects[0]), freeFn)
+	obj.Free()
+	obj.Free()
+	if got := <-freed; got != uintptr(unsafe.Pointer(&objects[0])) {
+		t.Errorf("Free freed %#x wanted %#x", got, unsafe.Pointer(&objects[0]))
+	}
+	if obj.Pointer() != nil {
+		t.Errorf("Pointer returned %p after Free wanted nil", obj.Pointer())
+	}
+
+	// the finalizer frees the object after it is collected
+	purego.AttachFinalizer(unsafe.Pointer(&objects[1]), freeFn)
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		runtime.GC()
+		select {
+		case got := <-freed:
+			if got != uintptr(unsafe.Pointer(&objects[1])) {
+				t.Errorf("finalizer freed %#x wanted %#x", got, unsafe.Pointer(&objects[1]))
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the finalizer never freed the object")
+		}
+	}
+}
+
+func TestRegisterLibFuncWithFree(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	var newCounter func(start int32) *purego.CObject
+	var counterValue func(c unsafe.Pointer) int32
+	var freedCounters func() int32
+	purego.RegisterLibFuncWithFree(&newCounter, lib, "newCounter", "freeCounter")
+	purego.RegisterLibFunc(&counterValue, lib, "counterValue")
+	purego.RegisterLibFunc(&freedCounters, lib, "freedCounters")
+
+	obj := newCounter(5)
+	if got := counterValue(obj.Pointer()); got != 5 {
+		t.Errorf("counterValue returned %d wanted %d", got, 5)
+	}
+	obj.Free()
+	if got := freedCounters(); got != 1 {
+		t.Errorf("Free freed %d counters wanted %d", got, 1)
+	}
+	if obj := newCounter(-1); obj.Pointer() != nil {
+		t.Errorf("Pointer of a NULL return value is %p wanted nil", obj.Pointer())
+	}
+
+	// the finalizer frees the counter after it is collected
+	newCounter(6)
+	for deadline := time.Now().Add(10 * time.Second); freedCounters() != 2; time.Sleep(10 * time.Millisecond) {
+		runtime.GC()
+		if time.Now().After(deadline) {
+			t.Fatal("the finalizer never freed the counter")
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("RegisterLibFuncWithFree of a function that doesn't return a *CObject didn't panic")
+		}
+	}()
+	var wrong func(start int32) unsafe.Pointer
+	purego.RegisterLibFuncWithFree(&wrong, lib, "newCounter", "freeCounter")
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// checkGoPointers panics if the argument v of a C function points to Go memory that holds a Go pointer,
+// which breaks the Cgo rules. It is only called in builds with the purego_cgocheck tag. Only the values
+// that are always Go pointers are reported since a *T or an unsafe.Pointer may also point to C memory.
+func checkGoPointers(i int, v reflect.Value) {
+	var path string
+	var found bool
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		path, found = findGoPointer(v.Elem(), "(*p)")
+	case reflect.Slice:
+		if v.Type() == stringArrayType {
+			// the strings are copied into C memory that is made for the call
+			return
+		}
+		// a slice passes a pointer to its first element
+		for j := 0; j < v.Len() && !found; j++ {
+			path, found = findGoPointer(v.Index(j), "p["+strconv.Itoa(j)+"]")
+		}
+	case reflect.Struct:
+		// the fields of a struct are passed instead of the struct so each one is checked like an argument
+		for j := 0; j < v.NumField(); j++ {
+			checkGoPointers(i, v.Field(j))
+		}
+	}
+	if found {
+		panic("purego: argument " + strconv.Itoa(i) + " of type " + v.Type().String() +
+			" points to Go memory that holds a Go pointer in " + path)
+	}
+}
+
+// findGoPointer returns the path to a value in v which is always a Go pointer. It doesn't follow pointers.
+func findGoPointer(v reflect.Value, path string) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() > 0 {
+			return path + " (string)", true
+		}
+	case reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		if !v.IsNil() {
+			return path + " (" + v.Kind().String() + ")", true
+		}
+	case reflect.Array:
+		for j := 0; j < v.Len(); j++ {
+			if p, ok := findGoPointer(v.Index(j), path+"["+strconv.Itoa(j)+"]"); ok {
+				return p, true
+			}
+		}
+	case reflect.Struct:
+		for j := 0; j < v.NumField(); j++ {
+			if p, ok := findGoPointer(v.Field(j), path+"."+v.Type().Field(j).Name); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build purego_cgocheck
+
+package purego
+
+// cgocheck is true in builds with the purego_cgocheck tag so that the arguments of every call are checked for Go pointers.
+const cgocheck = true
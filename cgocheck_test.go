@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build purego_cgocheck
+
+package purego_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ebitengine/purego"
+	"github.com/ebitengine/purego/internal/load"
+)
+
+func TestCgocheck(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	type plain struct {
+		a, b int32
+		p    *int32
+	}
+	type withString struct {
+		n    int32
+		name string
+	}
+	// memset doesn't write anything with a size of 0 so only the arguments are checked
+	var memsetPlain func(s *plain, c int32, n purego.Size)
+	purego.RegisterLibFunc(&memsetPlain, libc, "memset")
+	var memsetString func(s *withString, c int32, n purego.Size)
+	purego.RegisterLibFunc(&memsetString, libc, "memset")
+	var memsetStrings func(s []string, c int32, n purego.Size)
+	purego.RegisterLibFunc(&memsetStrings, libc, "memset")
+
+	memsetPlain(&plain{p: new(int32)}, 0, 0)
+	memsetString(&withString{n: 1}, 0, 0)
+	memsetStrings([]string{""}, 0, 0)
+
+	for _, test := range []struct {
+		name string
+		call func()
+		want string
+	}{
+		{"string field", func() { memsetString(&withString{name: "purego"}, 0, 0) }, "(*p).name (string)"},
+		{"string element", func() { memsetStrings([]string{"", "purego"}, 0, 0) }, "p[1] (string)"},
+	} {
+		func() {
+			defer func() {
+				r, _ := recover().(string)
+				if !strings.Contains(r, test.want) {
+					t.Errorf("%s: got panic %q wanted one that mentions %q", test.name, r, test.want)
+				}
+			}()
+			test.call()
+		}()
+	}
+}
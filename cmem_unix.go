@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux
+
+package purego
+
+import (
+	"sync"
+	"unsafe"
+)
+
+var (
+	fnMalloc     func(size uintptr) unsafe.Pointer
+	fnFree       func(ptr unsafe.Pointer)
+	fnMallocErr  error
+	fnMallocOnce sync.Once
+)
+
+// cMalloc allocates size bytes of C memory that must be released with cFree.
+func cMalloc(size uintptr) unsafe.Pointer {
+	fnMallocOnce.Do(func() {
+		malloc, err := Dlsym(RTLD_DEFAULT, "malloc")
+		if err != nil {
+			fnMallocErr = err
+			return
+		}
+		free, err := Dlsym(RTLD_DEFAULT, "free")
+		if err != nil {
+			fnMallocErr = err
+			return
+		}
+		RegisterFunc(&fnMalloc, malloc)
+		RegisterFunc(&fnFree, free)
+	})
+	if fnMallocErr != nil {
+		panic(fnMallocErr)
+	}
+	p := fnMalloc(size)
+	if p == nil {
+		panic("purego: out of C memory")
+	}
+	return p
+}
+
+// cFree releases the memory returned by cMalloc.
+func cFree(ptr unsafe.Pointer) {
+	fnFree(ptr)
+}
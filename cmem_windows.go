@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procLocalAlloc = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalAlloc")
+	procLocalFree  = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalFree")
+)
+
+// cMalloc allocates size bytes of memory outside of the Go heap that must be released with cFree.
+func cMalloc(size uintptr) unsafe.Pointer {
+	const LMEM_FIXED = 0
+	p, _, _ := procLocalAlloc.Call(LMEM_FIXED, size)
+	if p == 0 {
+		panic("purego: out of C memory")
+	}
+	// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+	return *(*unsafe.Pointer)(unsafe.Pointer(&p))
+}
+
+// cFree releases the memory returned by cMalloc.
+func cFree(ptr unsafe.Pointer) {
+	procLocalFree.Call(uintptr(ptr))
+}
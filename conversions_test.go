@@ -0,0 +1,326 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build (darwin || freebsd || linux) && (amd64 || arm64)
+
+package purego_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// TestTypeConversions checks every row of the Type Conversions table of RegisterFunc in both directions
+// where the table allows it. Keep it in sync with the table when a conversion is added.
+func TestTypeConversions(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "convtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "convtest", "conversions_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(libFileName) })
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+
+	t.Run("string", func(t *testing.T) {
+		echo(t, lib, "EchoString", "", "hello", "世界")
+	})
+	t.Run("WString", func(t *testing.T) {
+		echo[purego.WString](t, lib, "EchoWString", "", "hello", "世界")
+	})
+	t.Run("StringArray", func(t *testing.T) {
+		var stringAt func(argv purego.StringArray, i purego.Size) string
+		purego.RegisterLibFunc(&stringAt, lib, "StringAt")
+		argv := purego.StringArray{"a", "bc", "def"}
+		for i, want := range argv {
+			if got := stringAt(argv, purego.Size(i)); got != want {
+				t.Errorf("StringAt(%d) returned %q wanted %q", i, got, want)
+			}
+		}
+	})
+	t.Run("bool", func(t *testing.T) {
+		echo(t, lib, "EchoBool", false, true)
+		widen[bool, uint64](t, lib, "WidenBool", map[bool]uint64{false: 0, true: 1})
+	})
+	t.Run("WinBool", func(t *testing.T) {
+		echo[purego.WinBool](t, lib, "EchoInt32", 0, 1, -1)
+		var echoWinBool func(b purego.WinBool) purego.WinBool
+		purego.RegisterLibFunc(&echoWinBool, lib, "EchoInt32")
+		// any value that isn't 0 is TRUE including the ones with the lowest byte cleared
+		if !echoWinBool(0x100).Bool() {
+			t.Errorf("EchoInt32(0x100) returned FALSE wanted TRUE")
+		}
+	})
+	t.Run("uintptr", func(t *testing.T) {
+		echo[uintptr](t, lib, "EchoUintptr", 0, 1, math.MaxUint64)
+	})
+	t.Run("uint", func(t *testing.T) {
+		echo[uint](t, lib, "EchoUint64", 0, 1, math.MaxUint64)
+	})
+	t.Run("uint8", func(t *testing.T) {
+		echo[uint8](t, lib, "EchoUint8", 0, 1, math.MaxUint8)
+		widen[uint8, uint64](t, lib, "WidenUint8", map[uint8]uint64{math.MaxUint8: math.MaxUint8})
+		narrow[uint8](t, lib, "NarrowUint8", map[uint64]uint8{0xFFFF_FF01: 1})
+	})
+	t.Run("uint16", func(t *testing.T) {
+		echo[uint16](t, lib, "EchoUint16", 0, 1, math.MaxUint16)
+		widen[uint16, uint64](t, lib, "WidenUint16", map[uint16]uint64{math.MaxUint16: math.MaxUint16})
+		narrow[uint16](t, lib, "NarrowUint16", map[uint64]uint16{0xFFFF_0001: 1})
+	})
+	t.Run("uint32", func(t *testing.T) {
+		echo[uint32](t, lib, "EchoUint32", 0, 1, math.MaxUint32)
+		widen[uint32, uint64](t, lib, "WidenUint32", map[uint32]uint64{math.MaxUint32: math.MaxUint32})
+		narrow[uint32](t, lib, "NarrowUint32", map[uint64]uint32{0xFFFF_FFFF_0000_0001: 1})
+	})
+	t.Run("uint64", func(t *testing.T) {
+		echo[uint64](t, lib, "EchoUint64", 0, 1, math.MaxUint64)
+	})
+	t.Run("int", func(t *testing.T) {
+		echo[int](t, lib, "EchoInt64", 0, -1, math.MinInt64, math.MaxInt64)
+	})
+	t.Run("int8", func(t *testing.T) {
+		echo[int8](t, lib, "EchoInt8", 0, -1, math.MinInt8, math.MaxInt8)
+		widen[int8, int64](t, lib, "WidenInt8", map[int8]int64{-1: -1, math.MinInt8: math.MinInt8})
+		narrow[int8](t, lib, "NarrowInt8", map[uint64]int8{0x1FF: -1, 0xFF01: 1})
+	})
+	t.Run("int16", func(t *testing.T) {
+		echo[int16](t, lib, "EchoInt16", 0, -1, math.MinInt16, math.MaxInt16)
+		widen[int16, int64](t, lib, "WidenInt16", map[int16]int64{-1: -1, math.MinInt16: math.MinInt16})
+		narrow[int16](t, lib, "NarrowInt16", map[uint64]int16{0x1FFFF: -1, 0xFFFF_0001: 1})
+	})
+	t.Run("int32", func(t *testing.T) {
+		echo[int32](t, lib, "EchoInt32", 0, -1, math.MinInt32, math.MaxInt32)
+		widen[int32, int64](t, lib, "WidenInt32", map[int32]int64{-1: -1, math.MinInt32: math.MinInt32})
+		narrow[int32](t, lib, "NarrowInt32", map[uint64]int32{0x1_FFFF_FFFF: -1, 0xFFFF_FFFF_0000_0001: 1})
+	})
+	t.Run("int64", func(t *testing.T) {
+		echo[int64](t, lib, "EchoInt64", 0, -1, math.MinInt64, math.MaxInt64)
+	})
+	t.Run("float32", func(t *testing.T) {
+		echo[float32](t, lib, "EchoFloat", 0, -1.5, math.MaxFloat32, math.SmallestNonzeroFloat32)
+	})
+	t.Run("float64", func(t *testing.T) {
+		echo[float64](t, lib, "EchoDouble", 0, -1.5, math.MaxFloat64, math.SmallestNonzeroFloat64)
+	})
+	t.Run("enum", func(t *testing.T) {
+		type color int32
+		const (
+			colorNone color = iota - 1
+			colorRed
+			colorGreen
+			colorBlue
+		)
+		var nextColor func(c color) color
+		purego.RegisterLibFunc(&nextColor, lib, "NextColor")
+		for c, want := range map[color]color{colorNone: colorRed, colorRed: colorGreen, colorBlue: colorNone} {
+			if got := nextColor(c); got != want {
+				t.Errorf("NextColor(%d) returned %d wanted %d", c, got, want)
+			}
+		}
+		type glenum uint32
+		echo[glenum](t, lib, "EchoUint32", 0x0500, math.MaxUint32)
+	})
+	t.Run("struct", func(t *testing.T) {
+		if runtime.GOOS != "darwin" && !(runtime.GOOS == "linux" && runtime.GOARCH == "amd64") {
+			t.Skip("structs are only supported on darwin and linux amd64")
+		}
+		type pair struct {
+			A int64
+			B float64
+		}
+		echo(t, lib, "EchoPair", pair{}, pair{A: -1, B: 2.5})
+	})
+	t.Run("NULL", func(t *testing.T) {
+		type pair struct {
+			A int64
+			B float64
+		}
+		var newPair func(ok bool) *pair
+		purego.RegisterLibFunc(&newPair, lib, "NewPair")
+		if p := newPair(false); p != nil {
+			t.Errorf("NewPair(false) returned %p wanted nil", p)
+		}
+		if p := newPair(true); p == nil || *p != (pair{A: 1, B: 2.5}) {
+			t.Errorf("NewPair(true) returned %v wanted &{1 2.5}", p)
+		}
+		var newPointer func(ok bool) unsafe.Pointer
+		purego.RegisterLibFunc(&newPointer, lib, "NewPair")
+		if p := newPointer(false); p != nil {
+			t.Errorf("NewPair(false) returned %p wanted nil", p)
+		}
+	})
+	t.Run("float pair", func(t *testing.T) {
+		var splitDouble func(x float64) (float64, float64)
+		purego.RegisterLibFunc(&splitDouble, lib, "SplitDouble")
+		if a, b := splitDouble(1.25); a != 2.5 || b != -1.25 {
+			t.Errorf("SplitDouble(1.25) returned %v, %v wanted 2.5, -1.25", a, b)
+		}
+		if runtime.GOARCH != "arm64" {
+			// a struct of two floats is returned packed into the first float register
+			return
+		}
+		var splitFloat func(x float32) (float32, float32)
+		purego.RegisterLibFunc(&splitFloat, lib, "SplitFloat")
+		if a, b := splitFloat(1.25); a != 2.5 || b != -1.25 {
+			t.Errorf("SplitFloat(1.25) returned %v, %v wanted 2.5, -1.25", a, b)
+		}
+	})
+	t.Run("M128", func(t *testing.T) {
+		var addVectors func(a, b *[4]float32) purego.M128
+		purego.RegisterLibFunc(&addVectors, lib, "AddVectors")
+		a, b := [4]float32{1, 2, 3, 4}, [4]float32{0.5, 10, 100, -8}
+		if got, want := addVectors(&a, &b).Float32s(), [4]float32{1.5, 12, 103, -4}; got != want {
+			t.Errorf("AddVectors returned %v wanted %v", got, want)
+		}
+	})
+	t.Run("func", func(t *testing.T) {
+		var getSubtract func() func(a, b int64) int64
+		purego.RegisterLibFunc(&getSubtract, lib, "GetSubtract")
+		if got := getSubtract()(5, 3); got != 2 {
+			t.Errorf("the function returned from GetSubtract returned %d wanted 2", got)
+		}
+		var apply func(op func(a, b int64) int64, a, b int64) int64
+		purego.RegisterLibFunc(&apply, lib, "Apply")
+		if got := apply(func(a, b int64) int64 { return a * b }, 5, 3); got != 15 {
+			t.Errorf("Apply returned %d wanted 15", got)
+		}
+		// a function that calls a C function is passed as the C function instead of as a callback
+		var isSubtract func(op func(a, b int64) int64) bool
+		purego.RegisterLibFunc(&isSubtract, lib, "IsSubtract")
+		if !isSubtract(getSubtract()) {
+			t.Errorf("IsSubtract(GetSubtract()) returned false wanted true")
+		}
+		if got := apply(getSubtract(), 5, 3); got != 2 {
+			t.Errorf("Apply(GetSubtract()) returned %d wanted 2", got)
+		}
+	})
+	t.Run("callback", func(t *testing.T) {
+		var callKinds func(cb func(bool, int8, uint16, int32, uint64, float32, float64, *int32) int64) int64
+		purego.RegisterLibFunc(&callKinds, lib, "CallKinds")
+		got := callKinds(func(b bool, i8 int8, u16 uint16, i32 int32, u64 uint64, f32 float32, f64 float64, p *int32) int64 {
+			if !b || i8 != -8 || u16 != 16 || i32 != -32 || u64 != 64 || f32 != 1.5 || f64 != 2.25 || *p != 42 {
+				t.Errorf("the callback got (%v, %d, %d, %d, %d, %v, %v, %d) wanted (true, -8, 16, -32, 64, 1.5, 2.25, 42)", b, i8, u16, i32, u64, f32, f64, *p)
+			}
+			return -1
+		})
+		if got != -1 {
+			t.Errorf("CallKinds returned %d wanted -1", got)
+		}
+	})
+	t.Run("unsafe.Pointer", func(t *testing.T) {
+		var x int
+		echo(t, lib, "EchoPointer", nil, unsafe.Pointer(&x))
+	})
+	t.Run("*T", func(t *testing.T) {
+		var x int
+		echo(t, lib, "EchoPointer", nil, &x)
+		var valuePointer func() *int32
+		purego.RegisterLibFunc(&valuePointer, lib, "ValuePointer")
+		if got := *valuePointer(); got != 42 {
+			t.Errorf("ValuePointer pointed to %d wanted 42", got)
+		}
+	})
+	t.Run("CPtr", func(t *testing.T) {
+		var valuePointer func() purego.CPtr
+		purego.RegisterLibFunc(&valuePointer, lib, "ValuePointer")
+		p := valuePointer()
+		if got := *(*int32)(p.Pointer()); got != 42 {
+			t.Errorf("ValuePointer pointed to %d wanted 42", got)
+		}
+		echo(t, lib, "EchoPointer", 0, p)
+	})
+	t.Run("[]T", func(t *testing.T) {
+		var sum func(p []int32, n purego.Size) int64
+		purego.RegisterLibFunc(&sum, lib, "SumInt32s")
+		if got := sum([]int32{1, -2, 3}, 3); got != 2 {
+			t.Errorf("SumInt32s returned %d wanted 2", got)
+		}
+	})
+	t.Run("any", func(t *testing.T) {
+		var echoInt64 func(x any) int64
+		purego.RegisterLibFunc(&echoInt64, lib, "EchoInt64")
+		if got := echoInt64(int64(-1)); got != -1 {
+			t.Errorf("EchoInt64(any(-1)) returned %d wanted -1", got)
+		}
+		var echoPointer func(p any) unsafe.Pointer
+		purego.RegisterLibFunc(&echoPointer, lib, "EchoPointer")
+		if got := echoPointer(nil); got != nil {
+			t.Errorf("EchoPointer(nil) returned %p wanted nil", got)
+		}
+	})
+	t.Run("Counted[T]", func(t *testing.T) {
+		var sum func(p purego.Counted[int32]) int64
+		purego.RegisterLibFunc(&sum, lib, "SumInt32s")
+		if got := sum(purego.Counted[int32]{1, -2, 3}); got != 2 {
+			t.Errorf("SumInt32s returned %d wanted 2", got)
+		}
+		if got := sum(nil); got != 0 {
+			t.Errorf("SumInt32s(nil) returned %d wanted 0", got)
+		}
+		var scaleFloats func(scale float64, p purego.Counted[float32], bias float32) float64
+		purego.RegisterLibFunc(&scaleFloats, lib, "ScaleFloats")
+		if got := scaleFloats(2, purego.Counted[float32]{0.5, 1.5, 2}, 0.25); got != 8.25 {
+			t.Errorf("ScaleFloats returned %v wanted 8.25", got)
+		}
+		var sumDoubles func(p purego.Counted[float64]) float64
+		purego.RegisterLibFunc(&sumDoubles, lib, "SumDoubles")
+		if got := sumDoubles(purego.Counted[float64]{0.5, -1, 4}); got != 3.5 {
+			t.Errorf("SumDoubles returned %v wanted 3.5", got)
+		}
+	})
+	t.Run("Size", func(t *testing.T) {
+		echo[purego.Size](t, lib, "EchoSize", 0, math.MaxUint64)
+	})
+	t.Run("SSize", func(t *testing.T) {
+		echo[purego.SSize](t, lib, "EchoSSize", 0, -1, math.MaxInt64)
+	})
+	t.Run("TimeT", func(t *testing.T) {
+		echo[purego.TimeT](t, lib, "EchoTimeT", 0, -1, 1<<40)
+	})
+}
+
+// echo checks that the C function name returns each of values unchanged.
+func echo[T comparable](t *testing.T, lib uintptr, name string, values ...T) {
+	t.Helper()
+	var fn func(T) T
+	purego.RegisterLibFunc(&fn, lib, name)
+	for _, v := range values {
+		if got := fn(v); got != v {
+			t.Errorf("%s(%v) returned %v", name, v, got)
+		}
+	}
+}
+
+// widen checks that the C function name returns each narrow key extended to the wide value.
+func widen[T, W comparable](t *testing.T, lib uintptr, name string, values map[T]W) {
+	t.Helper()
+	var fn func(T) W
+	purego.RegisterLibFunc(&fn, lib, name)
+	for v, want := range values {
+		if got := fn(v); got != want {
+			t.Errorf("%s(%v) returned %v wanted %v", name, v, got, want)
+		}
+	}
+}
+
+// narrow checks that the C function name returns the low bits of each key as the value.
+func narrow[T comparable](t *testing.T, lib uintptr, name string, values map[uint64]T) {
+	t.Helper()
+	var fn func(uint64) T
+	purego.RegisterLibFunc(&fn, lib, name)
+	for v, want := range values {
+		if got := fn(v); got != want {
+			t.Errorf("%s(%#x) returned %v wanted %v", name, v, got, want)
+		}
+	}
+}
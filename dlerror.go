@@ -15,3 +15,17 @@ type Dlerror struct {
 func (e Dlerror) Error() string {
 	return e.s
 }
+
+// MustDlopen is like Dlopen but panics if the library can't be opened. The panic has the message of dlerror
+// which names the library and explains why it failed. This makes opening the libraries that a program can't run without concise:
+//
+//	libc := purego.MustDlopen("libc.so.6", purego.RTLD_NOW|purego.RTLD_GLOBAL)
+//
+// This function is not available on Windows.
+func MustDlopen(path string, mode int) uintptr {
+	handle, err := Dlopen(path, mode)
+	if err != nil {
+		panic("purego: " + err.Error())
+	}
+	return handle
+}
@@ -6,20 +6,23 @@
 package purego
 
 import (
+	"runtime"
 	"unsafe"
 )
 
 // Unix Specification for dlfcn.h: https://pubs.opengroup.org/onlinepubs/7908799/xsh/dlfcn.h.html
 
 var (
-	fnDlopen  func(path string, mode int) uintptr
-	fnDlsym   func(handle uintptr, name string) uintptr
-	fnDlerror func() string
-	fnDlclose func(handle uintptr) bool
+	fnDlopen        func(path string, mode int) uintptr
+	fnDlopenProgram func(path unsafe.Pointer, mode int) uintptr // dlopen with a NULL path
+	fnDlsym         func(handle uintptr, name string) uintptr
+	fnDlerror       func() string
+	fnDlclose       func(handle uintptr) bool
 )
 
 func init() {
 	RegisterFunc(&fnDlopen, dlopenABI0)
+	RegisterFunc(&fnDlopenProgram, dlopenABI0)
 	RegisterFunc(&fnDlsym, dlsymABI0)
 	RegisterFunc(&fnDlerror, dlerrorABI0)
 	RegisterFunc(&fnDlclose, dlcloseABI0)
@@ -34,11 +37,26 @@ func init() {
 // reference count for the handle will be incremented. Therefore, all
 // Dlopen calls should be balanced with a Dlclose call.
 //
+// If it fails, the error holds the message of dlerror for this call. Since dlerror is per thread,
+// it is read on the same thread so other goroutines that use Dlopen, Dlsym or Dlclose at the same time
+// can't replace the message. This is also true for the errors of Dlsym and Dlclose.
+//
+// If path is empty, NULL is passed to dlopen which returns a handle to the main program. Dlsym with this handle
+// finds the symbols of the program itself and of the libraries that were loaded with it or with RTLD_GLOBAL.
+//
 // This function is not available on Windows.
 // Use [golang.org/x/sys/windows.LoadLibrary], [golang.org/x/sys/windows.LoadLibraryEx],
 // [golang.org/x/sys/windows.NewLazyDLL], or [golang.org/x/sys/windows.NewLazySystemDLL] for Windows instead.
 func Dlopen(path string, mode int) (uintptr, error) {
-	u := fnDlopen(path, mode)
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var u uintptr
+	if path == "" {
+		u = fnDlopenProgram(nil, mode)
+	} else {
+		u = fnDlopen(path, mode)
+	}
 	if u == 0 {
 		return 0, Dlerror{fnDlerror()}
 	}
@@ -50,9 +68,18 @@ func Dlopen(path string, mode int) (uintptr, error) {
 // in the specified library or any of the libraries that were automatically loaded by Dlopen
 // when that library was loaded, Dlsym returns zero.
 //
+// The returned address is the address of the symbol's definition and not a lazy binding stub,
+// so calling it never has to resolve that symbol first. However, the calls that the library makes
+// into its own dependencies are still bound lazily on first use when it was opened with RTLD_LAZY.
+// Open the library with RTLD_NOW if all of these must be resolved before Dlopen returns, for example
+// when the function is first called from a real-time audio thread.
+//
 // This function is not available on Windows.
 // Use [golang.org/x/sys/windows.GetProcAddress] for Windows instead.
 func Dlsym(handle uintptr, name string) (uintptr, error) {
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	u := fnDlsym(handle, name)
 	if u == 0 {
 		return 0, Dlerror{fnDlerror()}
@@ -67,6 +94,10 @@ func Dlsym(handle uintptr, name string) (uintptr, error) {
 // This function is not available on Windows.
 // Use [golang.org/x/sys/windows.FreeLibrary] for Windows instead.
 func Dlclose(handle uintptr) error {
+	forgetSymbols(handle)
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if fnDlclose(handle) {
 		return Dlerror{fnDlerror()}
 	}
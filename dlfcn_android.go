@@ -3,7 +3,11 @@
 
 package purego
 
-import "github.com/ebitengine/purego/internal/cgo"
+import (
+	"errors"
+
+	"github.com/ebitengine/purego/internal/cgo"
+)
 
 // Source for constants: https://android.googlesource.com/platform/bionic/+/refs/heads/main/libc/include/dlfcn.h
 
@@ -26,9 +30,18 @@ func Dlsym(handle uintptr, name string) (uintptr, error) {
 }
 
 func Dlclose(handle uintptr) error {
+	forgetSymbols(handle)
 	return cgo.Dlclose(handle)
 }
 
 func loadSymbol(handle uintptr, name string) (uintptr, error) {
 	return Dlsym(handle, name)
 }
+
+func loadBase(handle uintptr) (uintptr, error) {
+	return 0, errors.New("purego: SymbolAtOffset is not supported on Android")
+}
+
+func loadSymbols(handle uintptr) ([]string, error) {
+	return nil, errors.New("purego: Symbols is not supported on Android")
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux
+
+package purego
+
+import "sync"
+
+type symbolKey struct {
+	handle uintptr
+	name   string
+}
+
+// symbols maps a symbolKey to the address returned by Dlsym.
+var symbols sync.Map
+
+// DlsymCached is like Dlsym but remembers the addresses it found so that looking up the same symbol
+// of the same handle again doesn't call into the dynamic linker. It is safe to call from multiple goroutines.
+// Symbols that aren't found are not remembered. Closing a handle with Dlclose forgets all its symbols.
+//
+// This function is not available on Windows.
+func DlsymCached(handle uintptr, name string) (uintptr, error) {
+	key := symbolKey{handle: handle, name: name}
+	if sym, ok := symbols.Load(key); ok {
+		return sym.(uintptr), nil
+	}
+	sym, err := Dlsym(handle, name)
+	if err != nil {
+		return 0, err
+	}
+	symbols.Store(key, sym)
+	return sym, nil
+}
+
+// forgetSymbols removes the symbols of handle from the cache of DlsymCached
+// since a handle that was closed may be returned by Dlopen for another library.
+func forgetSymbols(handle uintptr) {
+	symbols.Range(func(key, _ any) bool {
+		if key.(symbolKey).handle == handle {
+			symbols.Delete(key)
+		}
+		return true
+	})
+}
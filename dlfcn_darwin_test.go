@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego_test
+
+import (
+	"testing"
+
+	"github.com/ebitengine/purego"
+)
+
+func TestOpenFramework(t *testing.T) {
+	for _, name := range []string{
+		"Foundation",
+		"Foundation.framework",
+		"/System/Library/Frameworks/Foundation.framework",
+	} {
+		handle, err := purego.OpenFramework(name)
+		if err != nil {
+			t.Errorf("OpenFramework(%q) failed: %v", name, err)
+			continue
+		}
+		if _, err := purego.Dlsym(handle, "NSLog"); err != nil {
+			t.Errorf("Dlsym(NSLog) in %q failed: %v", name, err)
+		}
+	}
+	if _, err := purego.OpenFramework("PuregoFrameworkThatDoesNotExist"); err == nil {
+		t.Errorf("OpenFramework didn't fail for a missing framework")
+	}
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+import (
+	"path"
+	"strings"
+)
+
+// frameworkDirs are the directories that frameworks are searched for in by OpenFramework.
+var frameworkDirs = []string{"/System/Library/Frameworks", "/Library/Frameworks"}
+
+// OpenFramework opens the macOS or iOS framework called name with Dlopen, so that
+//
+//	purego.OpenFramework("Foundation")
+//
+// is the same as
+//
+//	purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_NOW|purego.RTLD_GLOBAL)
+//
+// The name may also end in .framework or be the path of a .framework directory. A framework without a path is
+// searched for in /System/Library/Frameworks and then /Library/Frameworks. Inside the framework directory, the binary
+// at the top level is tried first followed by the one in Versions/Current and then Versions/A for frameworks
+// that don't have the symbolic links. It does work for the system frameworks that are only in the dyld shared cache
+// and not on disk. The framework is opened with RTLD_GLOBAL so that Objective-C classes in it can be found by name.
+func OpenFramework(name string) (uintptr, error) {
+	dirs := frameworkDirs
+	if strings.Contains(name, "/") {
+		dirs = []string{path.Dir(name)}
+		name = path.Base(name)
+	}
+	name = strings.TrimSuffix(name, ".framework")
+	var firstErr error
+	for _, dir := range dirs {
+		framework := path.Join(dir, name+".framework")
+		for _, version := range []string{"", "Versions/Current", "Versions/A"} {
+			handle, err := Dlopen(path.Join(framework, version, name), RTLD_NOW|RTLD_GLOBAL)
+			if err == nil {
+				return handle, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return 0, firstErr
+}
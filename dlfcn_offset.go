@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux
+
+package purego
+
+// SymbolAtOffset takes a "handle" of a dynamic library returned by Dlopen and returns the address
+// that is offset bytes past the base address the library was loaded at. This can be used to call
+// functions that aren't exported by the library but are at a known offset in it:
+//
+//	fn, err := purego.SymbolAtOffset(handle, 0x1f40)
+//	if err != nil {
+//		panic(err)
+//	}
+//	purego.RegisterFunc(&hidden, fn)
+//
+// On Linux and FreeBSD, the base address is the load bias of the library, so offset is a virtual address
+// as shown by readelf or nm. For a shared library this is where its ELF header is loaded, but it is 0 for
+// an executable that isn't position independent. On macOS, it is the address of the Mach-O header.
+// Nothing checks that there is a function at the resulting address so the offset must match the exact build
+// of the library that is loaded. It always returns an error on Android.
+//
+// This function is not available on Windows.
+// Use the module handle returned by [golang.org/x/sys/windows.LoadLibrary] as the base address instead.
+func SymbolAtOffset(handle uintptr, offset uintptr) (uintptr, error) {
+	base, err := loadBase(handle)
+	if err != nil {
+		return 0, err
+	}
+	return base + offset, nil
+}
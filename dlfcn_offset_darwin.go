@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+const _RTLD_NOLOAD = 0x10
+
+var (
+	fnDyldImageCount  func() uint32
+	fnDyldImageName   func(i uint32) string
+	fnDyldImageHeader func(i uint32) uintptr
+	fnDyldErr         error
+	fnDyldOnce        sync.Once
+)
+
+func loadBase(handle uintptr) (uintptr, error) {
+	fnDyldOnce.Do(func() {
+		for _, f := range []struct {
+			fptr any
+			name string
+		}{
+			{&fnDyldImageCount, "_dyld_image_count"},
+			{&fnDyldImageName, "_dyld_get_image_name"},
+			{&fnDyldImageHeader, "_dyld_get_image_header"},
+		} {
+			sym, err := Dlsym(RTLD_DEFAULT, f.name)
+			if err != nil {
+				fnDyldErr = err
+				return
+			}
+			RegisterFunc(f.fptr, sym)
+		}
+	})
+	if fnDyldErr != nil {
+		return 0, fnDyldErr
+	}
+	// dyld doesn't map handles to images so find the image that
+	// returns the same handle when it is opened again.
+	for i := uint32(0); i < fnDyldImageCount(); i++ {
+		h := fnDlopen(fnDyldImageName(i), _RTLD_NOLOAD)
+		if h == 0 {
+			continue
+		}
+		fnDlclose(h)
+		if h == handle {
+			return fnDyldImageHeader(i), nil
+		}
+	}
+	return 0, errors.New("purego: no image is loaded for the handle")
+}
+
+// The load commands of a 64-bit Mach-O image from mach-o/loader.h.
+const (
+	_MH_MAGIC_64          = 0xfeedfacf
+	_LC_SEGMENT_64        = 0x19
+	_LC_DYLD_INFO         = 0x22
+	_LC_DYLD_INFO_ONLY    = 0x80000022
+	_LC_DYLD_EXPORTS_TRIE = 0x80000033
+	_machHeader64Size     = 32
+)
+
+func loadSymbols(handle uintptr) ([]string, error) {
+	header, err := loadBase(handle)
+	if err != nil {
+		return nil, err
+	}
+	if readAt[uint32](header) != _MH_MAGIC_64 {
+		return nil, errors.New("purego: the image isn't a 64-bit Mach-O image")
+	}
+	var (
+		textAddr, linkeditAddr, linkeditOffset uint64
+		hasText, hasLinkedit                   bool
+		exportsOffset, exportsSize             uint32
+	)
+	cmd := header + _machHeader64Size
+	for i := uint32(0); i < readAt[uint32](header+16); i++ {
+		switch readAt[uint32](cmd) {
+		case _LC_SEGMENT_64:
+			// struct segment_command_64 starts with the name of the segment after cmd and cmdsize
+			switch name := readAt[[16]byte](cmd + 8); string(bytes.TrimRight(name[:], "\x00")) {
+			case "__TEXT":
+				textAddr, hasText = readAt[uint64](cmd+24), true
+			case "__LINKEDIT":
+				linkeditAddr, linkeditOffset, hasLinkedit = readAt[uint64](cmd+24), readAt[uint64](cmd+40), true
+			}
+		case _LC_DYLD_INFO, _LC_DYLD_INFO_ONLY:
+			// export_off and export_size are the last fields of struct dyld_info_command
+			exportsOffset, exportsSize = readAt[uint32](cmd+40), readAt[uint32](cmd+44)
+		case _LC_DYLD_EXPORTS_TRIE:
+			// struct linkedit_data_command
+			exportsOffset, exportsSize = readAt[uint32](cmd+8), readAt[uint32](cmd+12)
+		}
+		cmd += uintptr(readAt[uint32](cmd + 4))
+	}
+	if exportsSize == 0 {
+		return nil, nil
+	}
+	if !hasText || !hasLinkedit {
+		return nil, errors.New("purego: the image has no __TEXT or __LINKEDIT segment")
+	}
+	// the segments are moved by the same slide when the image is loaded
+	slide := uint64(header) - textAddr
+	trie := uintptr(linkeditAddr + slide + uint64(exportsOffset) - linkeditOffset)
+	// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+	return exportTrieSymbols(unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&trie))), exportsSize))
+}
+
+// exportTrieSymbols returns the names of the symbols in the export trie of a Mach-O image without the underscore that
+// C symbols start with. Each node of the trie has the information of the symbol with the name of the path to it
+// if the name is exported followed by its children. The edge to each child has the next part of the name.
+func exportTrieSymbols(trie []byte) ([]string, error) {
+	errMalformed := errors.New("purego: the export trie of the image is malformed")
+	uleb := func(pos int) (uint64, int, bool) {
+		var v uint64
+		for shift := 0; pos < len(trie) && shift < 64; shift += 7 {
+			b := trie[pos]
+			pos++
+			v |= uint64(b&0x7f) << shift
+			if b&0x80 == 0 {
+				return v, pos, true
+			}
+		}
+		return 0, 0, false
+	}
+	type node struct {
+		offset int
+		prefix string
+	}
+	var names []string
+	nodes := []node{{0, ""}}
+	visited := make(map[int]bool)
+	for len(nodes) > 0 {
+		n := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		if visited[n.offset] {
+			return nil, errMalformed
+		}
+		visited[n.offset] = true
+		size, pos, ok := uleb(n.offset)
+		if !ok || pos+int(size) >= len(trie) {
+			return nil, errMalformed
+		}
+		if size > 0 {
+			names = append(names, strings.TrimPrefix(n.prefix, "_"))
+		}
+		pos += int(size)
+		children := int(trie[pos])
+		pos++
+		for i := 0; i < children; i++ {
+			end := bytes.IndexByte(trie[pos:], 0)
+			if end < 0 {
+				return nil, errMalformed
+			}
+			edge := string(trie[pos : pos+end])
+			var child uint64
+			if child, pos, ok = uleb(pos + end + 1); !ok || child >= uint64(len(trie)) {
+				return nil, errMalformed
+			}
+			nodes = append(nodes, node{int(child), n.prefix + edge})
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build (freebsd || linux) && !android
+
+package purego
+
+import (
+	"debug/elf"
+	"os"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego/internal/strings"
+)
+
+// RTLD_DI_LINKMAP is the same on glibc, musl and FreeBSD.
+const _RTLD_DI_LINKMAP = 2
+
+var (
+	fnDlinfo     func(handle uintptr, request int32, info unsafe.Pointer) int32
+	fnDlinfoErr  error
+	fnDlinfoOnce sync.Once
+)
+
+// linkMap is the start of struct link_map from link.h.
+type linkMap struct {
+	addr uintptr // l_addr is the difference between the addresses in the library and in memory
+	name uintptr // l_name is the path of the library which is empty for the executable
+}
+
+func loadLinkMap(handle uintptr) (*linkMap, error) {
+	fnDlinfoOnce.Do(func() {
+		// dlinfo isn't in libdl.so.2 on every version of glibc so look it up
+		// once it is needed instead of linking to it.
+		sym, err := Dlsym(RTLD_DEFAULT, "dlinfo")
+		if err != nil {
+			fnDlinfoErr = err
+			return
+		}
+		RegisterFunc(&fnDlinfo, sym)
+	})
+	if fnDlinfoErr != nil {
+		return nil, fnDlinfoErr
+	}
+	var lm *linkMap
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if fnDlinfo(handle, _RTLD_DI_LINKMAP, unsafe.Pointer(&lm)) != 0 {
+		return nil, Dlerror{fnDlerror()}
+	}
+	return lm, nil
+}
+
+func loadBase(handle uintptr) (uintptr, error) {
+	lm, err := loadLinkMap(handle)
+	if err != nil {
+		return 0, err
+	}
+	return lm.addr, nil
+}
+
+func loadSymbols(handle uintptr) ([]string, error) {
+	lm, err := loadLinkMap(handle)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.GoString(lm.name)
+	if path == "" {
+		if path, err = os.Executable(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+	// .gnu.version has the version of every symbol of .dynsym including the null symbol that DynamicSymbols skips
+	var versions []byte
+	if sec := f.Section(".gnu.version"); sec != nil {
+		if versions, err = sec.Data(); err != nil {
+			return nil, err
+		}
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for i, sym := range syms {
+		// dlsym only finds the default version of a symbol, so it can't find one that only has hidden versions
+		// like the symbols that glibc keeps for binaries that were linked against an older version of it
+		if j := 2 * (i + 1); j+1 < len(versions) && f.ByteOrder.Uint16(versions[j:])&0x8000 != 0 {
+			continue
+		}
+		// only the symbols that are defined in the library and visible outside of it can be found by dlsym
+		if sym.Section == elf.SHN_UNDEF || elf.ST_VISIBILITY(sym.Other) == elf.STV_HIDDEN || elf.ST_VISIBILITY(sym.Other) == elf.STV_INTERNAL {
+			continue
+		}
+		if bind := elf.ST_BIND(sym.Info); bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+			continue
+		}
+		// the names of the versions like GLIBC_2.34 are absolute symbols at 0 and not symbols of the library
+		if sym.Section == elf.SHN_ABS && sym.Value == 0 {
+			continue
+		}
+		// a symbol with several versions like memcpy of glibc is listed once for each version
+		if !seen[sym.Name] {
+			seen[sym.Name] = true
+			names = append(names, sym.Name)
+		}
+	}
+	return names, nil
+}
@@ -12,7 +12,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"unsafe"
 
@@ -25,6 +27,254 @@ func TestSimpleDlsym(t *testing.T) {
 	}
 }
 
+func TestDlsymCached(t *testing.T) {
+	want, err := purego.Dlsym(purego.RTLD_DEFAULT, "dlsym")
+	if err != nil {
+		t.Fatalf("Dlsym with RTLD_DEFAULT failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := purego.DlsymCached(purego.RTLD_DEFAULT, "dlsym")
+		if err != nil {
+			t.Fatalf("DlsymCached with RTLD_DEFAULT failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("DlsymCached returned %#x wanted %#x", got, want)
+		}
+	}
+	if _, err := purego.DlsymCached(purego.RTLD_DEFAULT, "purego_symbol_that_does_not_exist"); err == nil {
+		t.Errorf("DlsymCached didn't fail for a missing symbol")
+	}
+}
+
+func TestDlopen_concurrentErrors(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		path := fmt.Sprintf("/purego/library/that/does/not/exist%d.so", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := purego.Dlopen(path, purego.RTLD_NOW)
+				if err == nil {
+					t.Errorf("Dlopen(%q) succeeded", path)
+					return
+				}
+				// the message of dlerror names the library that failed to open
+				if !strings.Contains(err.Error(), path) {
+					t.Errorf("Dlopen(%q) returned the error of another call: %v", path, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCallThenOnSameThread(t *testing.T) {
+	var dlopen func(path string, mode int32) uintptr
+	var dlerror func() string
+	purego.RegisterLibFunc(&dlopen, purego.RTLD_DEFAULT, "dlopen")
+	purego.RegisterLibFunc(&dlerror, purego.RTLD_DEFAULT, "dlerror")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		path := fmt.Sprintf("/purego/library/that/does/not/exist%d.so", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var handle uintptr
+				var msg string
+				purego.CallThenOnSameThread(func() {
+					handle = dlopen(path, purego.RTLD_NOW)
+					// let other goroutines run before the error is read
+					runtime.Gosched()
+				}, func() {
+					msg = dlerror()
+				})
+				if handle != 0 {
+					t.Errorf("dlopen(%q) succeeded", path)
+					return
+				}
+				if !strings.Contains(msg, path) {
+					t.Errorf("dlerror after dlopen(%q) returned the error of another call: %q", path, msg)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMustDlopen(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	if handle := purego.MustDlopen(library, purego.RTLD_NOW); handle == 0 {
+		t.Errorf("MustDlopen(%q) returned 0", library)
+	}
+
+	const path = "/purego/library/that/does/not/exist.so"
+	defer func() {
+		r, _ := recover().(string)
+		if !strings.HasPrefix(r, "purego: ") || !strings.Contains(r, path) {
+			t.Errorf("MustDlopen(%q) panicked with %q wanted the message of dlerror", path, r)
+		}
+	}()
+	purego.MustDlopen(path, purego.RTLD_NOW)
+}
+
+func TestDlopen_mainProgram(t *testing.T) {
+	handle, err := purego.Dlopen("", purego.RTLD_NOW)
+	if err != nil {
+		t.Fatalf("Dlopen(\"\") failed: %v", err)
+	}
+	defer purego.Dlclose(handle)
+	// the main program finds the symbols of the libraries that were loaded with it like libc
+	for _, name := range []string{"dlopen", "puts"} {
+		if _, err := purego.Dlsym(handle, name); err != nil {
+			t.Errorf("Dlsym(%q) with the handle of the main program failed: %v", name, err)
+		}
+	}
+	if again, err := purego.Dlopen("", purego.RTLD_NOW); err != nil || again != handle {
+		t.Errorf("Dlopen(\"\") returned %#x, %v the second time wanted %#x", again, err, handle)
+	} else {
+		purego.Dlclose(again)
+	}
+}
+
+func TestRegisterLibFuncFrom(t *testing.T) {
+	libFileName := filepath.Join(t.TempDir(), "libcbtest.so")
+	t.Logf("Build %v", libFileName)
+
+	if err := buildSharedLib("CC", libFileName, filepath.Join("testdata", "libcbtest", "callback_test.c")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(libFileName)
+
+	lib, err := purego.Dlopen(libFileName, purego.RTLD_NOW|purego.RTLD_LOCAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", libFileName, err)
+	}
+	defer purego.Dlclose(lib)
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := purego.Dlopen(library, purego.RTLD_NOW)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", library, err)
+	}
+
+	// the counter functions aren't in libc so they are found in the second handle
+	var newCounter func(start int32) unsafe.Pointer
+	var counterValue func(c unsafe.Pointer) int32
+	var freeCounter func(c unsafe.Pointer)
+	purego.RegisterLibFuncFrom(&newCounter, []uintptr{libc, lib}, "newCounter")
+	purego.RegisterLibFuncFrom(&counterValue, []uintptr{libc, lib}, "counterValue")
+	purego.RegisterLibFuncFrom(&freeCounter, []uintptr{libc, lib}, "freeCounter")
+	c := newCounter(7)
+	defer freeCounter(c)
+	if got := counterValue(c); got != 7 {
+		t.Errorf("counterValue returned %d wanted %d", got, 7)
+	}
+	// strlen is found in the first handle
+	var strlen func(s string) uintptr
+	purego.RegisterLibFuncFrom(&strlen, []uintptr{libc, lib}, "strlen")
+	if got := strlen("purego"); got != 6 {
+		t.Errorf("strlen returned %d wanted %d", got, 6)
+	}
+
+	const name = "purego_symbol_that_does_not_exist"
+	defer func() {
+		r, ok := recover().(error)
+		if !ok || !strings.Contains(r.Error(), name) {
+			t.Errorf("RegisterLibFuncFrom(%q) panicked with %v wanted the error of Dlsym", name, r)
+		}
+	}()
+	var missing func()
+	purego.RegisterLibFuncFrom(&missing, []uintptr{libc, lib}, name)
+}
+
+func TestSymbolAtOffset(t *testing.T) {
+	var library string
+	switch runtime.GOOS {
+	case "darwin":
+		library = "/usr/lib/libSystem.B.dylib"
+	case "freebsd":
+		library = "libc.so.7"
+	default:
+		library = "libc.so.6"
+	}
+	handle, err := purego.Dlopen(library, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", library, err)
+	}
+	defer purego.Dlclose(handle)
+
+	base, err := purego.SymbolAtOffset(handle, 0)
+	if err != nil {
+		t.Fatalf("SymbolAtOffset failed: %v", err)
+	}
+	magic := *(*[4]byte)(*(*unsafe.Pointer)(unsafe.Pointer(&base)))
+	if runtime.GOOS == "darwin" {
+		if magic != [4]byte{0xcf, 0xfa, 0xed, 0xfe} {
+			t.Fatalf("base %#x isn't a Mach-O header: % x", base, magic)
+		}
+	} else if magic != [4]byte{0x7f, 'E', 'L', 'F'} {
+		t.Fatalf("base %#x isn't an ELF header: % x", base, magic)
+	}
+
+	sym, err := purego.Dlsym(handle, "strlen")
+	if err != nil {
+		t.Fatalf("Dlsym failed: %v", err)
+	}
+	fn, err := purego.SymbolAtOffset(handle, sym-base)
+	if err != nil {
+		t.Fatalf("SymbolAtOffset failed: %v", err)
+	}
+	var strlen func(s string) int
+	purego.RegisterFunc(&strlen, fn)
+	if got := strlen("purego"); got != 6 {
+		t.Errorf("strlen returned %d wanted %d", got, 6)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	var library string
+	switch runtime.GOOS {
+	case "darwin":
+		// libSystem only re-exports the libraries that define the functions of libc
+		library = "/usr/lib/system/libsystem_c.dylib"
+	case "freebsd":
+		library = "libc.so.7"
+	default:
+		library = "libc.so.6"
+	}
+	handle, err := purego.Dlopen(library, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatalf("Dlopen(%q) failed: %v", library, err)
+	}
+	defer purego.Dlclose(handle)
+
+	names, err := purego.Symbols(handle)
+	if err != nil {
+		t.Fatalf("Symbols failed: %v", err)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Symbols returned unsorted names")
+	}
+	i := sort.SearchStrings(names, "puts")
+	if i == len(names) || names[i] != "puts" {
+		t.Fatalf("Symbols returned %d names without puts", len(names))
+	}
+	for _, name := range names {
+		if _, err := purego.Dlsym(handle, name); err != nil {
+			t.Errorf("Dlsym(%q) of a name returned by Symbols failed: %v", name, err)
+		}
+	}
+}
+
 func TestNestedDlopenCall(t *testing.T) {
 	libFileName := filepath.Join(t.TempDir(), "libdlnested.so")
 	t.Logf("Build %v", libFileName)
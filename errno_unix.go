@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux
+
+package purego
+
+import (
+	"runtime"
+	"sync"
+)
+
+var (
+	errnoFn     uintptr
+	errnoFnErr  error
+	errnoFnOnce sync.Once
+)
+
+// errnoLocation returns the C function that returns the address of errno for the thread that calls it.
+// errno is thread-local so it is called right after the C function on the same thread.
+func errnoLocation() uintptr {
+	errnoFnOnce.Do(func() {
+		var name string
+		switch runtime.GOOS {
+		case "darwin", "freebsd":
+			name = "__error"
+		case "android":
+			name = "__errno"
+		default:
+			// glibc and musl
+			name = "__errno_location"
+		}
+		errnoFn, errnoFnErr = Dlsym(RTLD_DEFAULT, name)
+	})
+	if errnoFnErr != nil {
+		panic(errnoFnErr)
+	}
+	return errnoFn
+}
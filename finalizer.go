@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// CObject owns a pointer to an object in C memory that is freed by a C function once the CObject
+// isn't reachable anymore, so the object doesn't have to be freed by hand. Create it with AttachFinalizer.
+type CObject struct {
+	lock   sync.Mutex
+	ptr    unsafe.Pointer
+	freeFn uintptr
+}
+
+// AttachFinalizer returns a CObject that calls the C function freeFn, which takes ptr as its only argument
+// like void free(void *ptr), when it is collected by the garbage collector:
+//
+//	// struct foo *foo_new(void); void foo_free(struct foo *);
+//	obj := purego.AttachFinalizer(fooNew(), fooFree)
+//	fooUse(obj.Pointer())
+//	runtime.KeepAlive(obj)
+//
+// The object is only freed after the CObject is unreachable, so keep the CObject alive for as long as ptr is
+// used, for example with runtime.KeepAlive, as the Go code that uses ptr doesn't keep it alive. Like all
+// finalizers freeFn runs on a goroutine of its own at some point after the collection or not at all if the
+// program exits before. Call Free to free the object at a known time instead.
+// If ptr is nil nothing is ever freed.
+func AttachFinalizer(ptr unsafe.Pointer, freeFn uintptr) *CObject {
+	if freeFn == 0 {
+		panic("purego: freeFn is nil")
+	}
+	o := &CObject{ptr: ptr, freeFn: freeFn}
+	if ptr != nil {
+		runtime.SetFinalizer(o, (*CObject).Free)
+	}
+	return o
+}
+
+// Pointer returns the pointer to the object or nil after it has been freed.
+func (o *CObject) Pointer() unsafe.Pointer {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.ptr
+}
+
+// Free frees the object now and removes the finalizer. It does nothing if the object was already freed.
+func (o *CObject) Free() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.ptr == nil {
+		return
+	}
+	runtime.SetFinalizer(o, nil)
+	SyscallN(o.freeFn, uintptr(o.ptr))
+	o.ptr = nil
+}
+
+var cObjectType = reflect.TypeOf((*CObject)(nil))
+
+// RegisterLibFuncWithFree is like RegisterLibFunc for a C function that returns a new object which must be freed
+// by the C function freeName. fptr must return a *CObject which has a finalizer attached with AttachFinalizer
+// that calls freeName, so the objects that the function creates can't leak:
+//
+//	// struct foo *foo_new(int size); void foo_free(struct foo *);
+//	var fooNew func(size int32) *purego.CObject
+//	purego.RegisterLibFuncWithFree(&fooNew, handle, "foo_new", "foo_free")
+//	obj := fooNew(16)
+//	fooUse(obj.Pointer())
+//	runtime.KeepAlive(obj)
+//
+// A NULL return value is a CObject whose Pointer is nil. It panics if it can't find either symbol.
+func RegisterLibFuncWithFree(fptr any, handle uintptr, name, freeName string) {
+	fn := reflect.ValueOf(fptr).Elem()
+	if fn.Kind() != reflect.Func {
+		panic("purego: fptr must be a function pointer")
+	}
+	ty := fn.Type()
+	if ty.NumOut() != 1 || ty.Out(0) != cObjectType {
+		panic("purego: the function must return a *CObject")
+	}
+	// the free function takes the pointer to the object
+	freeFn, err := loadFuncSymbol(handle, freeName, new(func(ptr unsafe.Pointer)))
+	if err != nil {
+		panic(err)
+	}
+	// register the same function returning the pointer and wrap what it returns in a CObject
+	ins := make([]reflect.Type, ty.NumIn())
+	for i := range ins {
+		ins[i] = ty.In(i)
+	}
+	newFn := reflect.New(reflect.FuncOf(ins, []reflect.Type{reflect.TypeOf(unsafe.Pointer(nil))}, ty.IsVariadic()))
+	RegisterLibFunc(newFn.Interface(), handle, name)
+	call := newFn.Elem().Call
+	if ty.IsVariadic() {
+		call = newFn.Elem().CallSlice
+	}
+	fn.Set(reflect.MakeFunc(ty, func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(AttachFinalizer(call(args)[0].UnsafePointer(), freeFn))}
+	}))
+}
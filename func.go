@@ -10,7 +10,9 @@ import (
 	"math"
 	"reflect"
 	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/ebitengine/purego/internal/strings"
@@ -20,21 +22,167 @@ var thePool = sync.Pool{New: func() any {
 	return new(syscall15Args)
 }}
 
+// converters maps a reflect.Type to the function registered for it in RegisterConverter.
+var converters sync.Map // map[reflect.Type]func(v reflect.Value) (ints []uintptr, floats []uintptr)
+
+// RegisterConverter registers a function that converts an argument of type t into the values
+// that are passed to a C function. It makes it possible to use types in RegisterFunc that purego doesn't
+// handle itself, like a custom fixed-point type, and it takes precedence over the builtin conversion of t.
+//
+// Each of the ints is placed in the next integer register (or on the stack) and each of the floats
+// in the next float register (or on the stack) in order. The convert function is also called with the zero
+// value of t when a function is registered to count the registers it uses, so it must always return the same
+// number of ints and floats. Only the argument itself is kept alive during the call, so any memory that the
+// returned values point to must be kept alive by the caller.
+//
+// RegisterConverter must be called before any function that takes an argument of type t is registered.
+func RegisterConverter(t reflect.Type, convert func(v reflect.Value) (ints []uintptr, floats []uintptr)) {
+	if t == nil {
+		panic("purego: type is nil")
+	}
+	if convert == nil {
+		panic("purego: convert is nil")
+	}
+	converters.Store(t, convert)
+}
+
+var tracer atomic.Value // func(name string, args []uintptr, ret uintptr)
+
+// SetTracer sets a function that is called after every call of a function registered by RegisterFunc
+// or RegisterLibFunc. It is meant for debugging bindings, like an argument that ends up in the wrong register,
+// and slows down every call while it is set. Calling SetTracer with nil removes the tracer.
+//
+// The name is the symbol passed to RegisterLibFunc and empty for functions registered with RegisterFunc.
+// The args are the values of the 15 integer argument slots (the integer registers followed by the stack)
+// and then of the 8 float registers as they were when the C function was called. The ret is the value
+// of the first integer return register.
+//
+// The tracer may be called from multiple goroutines at the same time.
+func SetTracer(trace func(name string, args []uintptr, ret uintptr)) {
+	tracer.Store(trace)
+}
+
+// loadFuncSymbol is loadSymbol for the function that fptr points to which also tries
+// the decorated name of a __stdcall function on 32-bit Windows if name isn't found.
+func loadFuncSymbol(handle uintptr, name string, fptr any) (uintptr, error) {
+	sym, err := loadSymbol(handle, name)
+	if err == nil || runtime.GOOS != "windows" || runtime.GOARCH != "386" {
+		return sym, err
+	}
+	if decorated, ok := stdcallName(name, reflect.TypeOf(fptr), unsafe.Sizeof(uintptr(0))); ok {
+		if sym, err := loadSymbol(handle, decorated); err == nil {
+			return sym, nil
+		}
+	}
+	return 0, err
+}
+
+// stdcallName returns the name that MSVC exports a __stdcall function with on 32-bit Windows when it
+// takes the arguments of the function that fptrType points to and pointers are ptrSize bytes. It reports false
+// if that can't be known because the function is variadic, takes an interface or uses the __cdecl calling convention.
+func stdcallName(name string, fptrType reflect.Type, ptrSize uintptr) (string, bool) {
+	if fptrType.Kind() != reflect.Pointer || fptrType.Elem().Kind() != reflect.Func || fptrType.Elem().IsVariadic() {
+		return "", false
+	}
+	ty := fptrType.Elem()
+	var n uintptr
+	for i := 0; i < ty.NumIn(); i++ {
+		// every argument takes a multiple of 4 bytes on the stack
+		switch arg := ty.In(i); {
+		case arg == reflect.TypeOf(CDecl{}):
+			return "", false
+		case arg.Implements(countedType):
+			n += 2 * ptrSize
+		case arg.Kind() == reflect.Interface:
+			return "", false
+		case arg.Kind() == reflect.String, arg.Kind() == reflect.Slice, arg.Kind() == reflect.Func:
+			// these are passed as a pointer
+			n += ptrSize
+		case arg.Kind() == reflect.Pointer, arg.Kind() == reflect.UnsafePointer,
+			arg.Kind() == reflect.Uintptr, arg.Kind() == reflect.Int, arg.Kind() == reflect.Uint:
+			n += ptrSize
+		default:
+			n += (arg.Size() + 3) &^ 3
+		}
+	}
+	return "_" + name + "@" + strconv.FormatUint(uint64(n), 10), true
+}
+
+func loadConverter(t reflect.Type) (func(v reflect.Value) (ints []uintptr, floats []uintptr), bool) {
+	convert, ok := converters.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return convert.(func(v reflect.Value) (ints []uintptr, floats []uintptr)), true
+}
+
 // RegisterLibFunc is a wrapper around RegisterFunc that uses the C function returned from Dlsym(handle, name).
-// It panics if it can't find the name symbol.
+// It panics if it can't find the name symbol. The handle may be RTLD_DEFAULT to find the symbol in the libraries
+// that are already loaded into the process without opening one, including on Windows.
+//
+// On 32-bit Windows a __stdcall function can be exported with its decorated name _name@N where N is the number
+// of bytes of its arguments. If name isn't found, the decorated name is computed from the arguments of fptr
+// and looked up instead, so the plain name can be used for these functions.
 func RegisterLibFunc(fptr any, handle uintptr, name string) {
-	sym, err := loadSymbol(handle, name)
+	sym, err := loadFuncSymbol(handle, name, fptr)
 	if err != nil {
 		panic(err)
 	}
-	RegisterFunc(fptr, sym)
+	registerFunc(fptr, sym, name, true)
+}
+
+// RegisterLibFuncWeak is like RegisterLibFunc but reports whether the name symbol was found instead of panicking.
+// If it isn't found fptr is set to nil, so calling it panics like calling any other nil function. This is useful
+// for symbols that only exist in some versions of a library so that a fallback can be used when they are missing.
+func RegisterLibFuncWeak(fptr any, handle uintptr, name string) bool {
+	fn := reflect.ValueOf(fptr).Elem()
+	if fn.Kind() != reflect.Func {
+		panic("purego: fptr must be a function pointer")
+	}
+	sym, err := loadFuncSymbol(handle, name, fptr)
+	if err != nil {
+		fn.Set(reflect.Zero(fn.Type()))
+		return false
+	}
+	registerFunc(fptr, sym, name, true)
+	return true
+}
+
+// RegisterLibFuncFrom is like RegisterLibFunc but looks up the name symbol in each of the handles in order
+// and uses the first one that has it. This is useful for a function that moved between libraries in different
+// versions or that is exported by one of several libraries that are opened. It only panics if none of the handles
+// have the symbol, with the error of the first handle.
+func RegisterLibFuncFrom(fptr any, handles []uintptr, name string) {
+	if len(handles) == 0 {
+		panic("purego: no handles to find " + name + " in")
+	}
+	var firstErr error
+	for _, handle := range handles {
+		sym, err := loadFuncSymbol(handle, name, fptr)
+		if err == nil {
+			registerFunc(fptr, sym, name, true)
+			return
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	panic(firstErr)
 }
 
 // RegisterFunc takes a pointer to a Go function representing the calling convention of the C function.
 // fptr will be set to a function that when called will call the C function given by cfn with the
-// parameters passed in the correct registers and stack.
+// parameters passed in the correct registers and stack. fptr can point to any variable of a function type,
+// including a field of a struct, so a struct of function fields can be used as the table of functions of a library:
 //
-// A panic is produced if the type is not a function pointer or if the function returns more than 1 value.
+//	type libc struct {
+//		Puts func(string) int32
+//	}
+//	var lib libc
+//	purego.RegisterLibFunc(&lib.Puts, handle, "puts")
+//
+// A panic is produced if the type is not a function pointer or if the function returns more than 1 value
+// (except for the two integer or float values described in Multiple Return Values).
 //
 // These conversions describe how a Go type in the fptr will be used to call
 // the C function. It is important to note that there is no way to verify that fptr
@@ -44,6 +192,8 @@ func RegisterLibFunc(fptr any, handle uintptr, name string) {
 // # Type Conversions (Go <=> C)
 //
 //	string <=> char*
+//	WString <=> wchar_t*
+//	StringArray <=> char** (NULL-terminated)
 //	bool <=> _Bool
 //	uintptr <=> uintptr_t
 //	uint <=> uint32_t or uint64_t
@@ -58,15 +208,152 @@ func RegisterLibFunc(fptr any, handle uintptr, name string) {
 //	int64 <=> int64_t
 //	float32 <=> float
 //	float64 <=> double
-//	struct <=> struct (WIP - darwin only)
+//	struct <=> struct (WIP - darwin and linux amd64 only, arguments on windows amd64)
 //	func <=> C function
 //	unsafe.Pointer, *T <=> void*
+//	CPtr <=> void* (C memory)
 //	[]T => void*
+//	any => the C type of the value it holds (NULL if it's nil)
+//	Counted[T] => T*, size_t
+//	CSlice[T] <= T*, size_t* (return only)
+//	Size <=> size_t
+//	SSize <=> ssize_t
+//	TimeT <=> time_t
+//	WinBool <=> BOOL (Windows)
+//	M128 <= __m128, __m128d, __m128i, float32x4_t (return only)
+//
+// A bool return value is a C _Bool which is only read from the lowest byte of the return register.
+// Use WinBool for the 4-byte BOOL of Windows whose TRUE is any value other than 0.
+//
+// A NULL pointer that a C function returns is a nil *T, unsafe.Pointer or func, so a factory function like
+// struct foo *foo_new(void) that returns NULL on failure can be checked with == nil. Declare the error described
+// in Errno as the second return value to also get errno for the NULL.
+//
+// A string argument is only for a const char* that the C function doesn't write to. A string that already ends
+// in \x00 is passed without a copy, so a C function that writes to it changes memory that Go expects to never change,
+// and the writes to a string that is copied are lost when the call returns. A char* buffer that the C function fills,
+// like the buffer of snprintf, must be a []byte or a *byte instead. Qualifiers like const and restrict aren't part
+// of the symbol of a C function, so purego can't check this and they don't change how an argument is passed.
+//
+// A func argument is passed as a callback made by NewCallback, unless it is a function that was set by RegisterFunc,
+// including a func returned from a C function, which is passed as the C function that it calls.
+// An array of function pointers, like a table of handlers that C calls later, is a []uintptr of the results of
+// NewCallback or of C function pointers. The slice is passed as a pointer to its first element like any other
+// slice and is only kept alive until the C function returns, so C must copy the array if it keeps it.
 //
 // There is a special case when the last argument of fptr is a variadic interface (or []interface}
 // it will be expanded into a call to the C function as if it had the arguments in that slice.
 // This means that using arg ...any is like a cast to the function with the arguments inside arg.
-// This is not the same as C variadic.
+// This is not the same as C variadic. A C variadic function like printf can still be called with the fixed arguments
+// followed by the variadic ones on amd64, where AL tells the callee that any float register may hold an argument, as long
+// as a float32 is promoted to a float64 like C does. Apple's arm64 calling convention passes the variadic arguments
+// on the stack instead, which purego doesn't do for them.
+//
+// Arguments that don't fit in registers are passed on the stack in 8-byte slots. An argument smaller than that,
+// like a bool which is 0 or 1, is extended to fill the whole slot so the C function reads the correct value
+// from the low bytes. Apple's arm64 calling convention instead packs the stack arguments by their size, which purego
+// doesn't do yet. On darwin/arm64 a stack argument smaller than 8 bytes is only read correctly if it is the last one
+// or is followed by an argument of 8 bytes.
+//
+// # Long Double
+//
+// There is no Go type for long double, so functions that take or return a long double or a long double _Complex
+// can't be called. On amd64 they are passed on the stack and returned in the x87 registers ST0 and ST1 which purego
+// never reads. Declaring such a return value as float64 doesn't fail but reads an unrelated register instead.
+// Complex return values panic when the function is registered. On darwin/arm64 and Windows long double is
+// the same as double so float64 works there.
+//
+// # Enums
+//
+// A C enum is passed and returned as the integer type that the C compiler picked for it, so it is declared as
+// a named Go integer type of the same width and signedness. C compilers use int for an enum unless one
+// of its constants doesn't fit, which makes int32 the Go type of most enums. Typedefs like GLenum name the
+// integer type themselves:
+//
+//	type GLenum uint32
+//
+//	// GLenum glGetError(void);
+//	var getError func() GLenum
+//
+// The signedness matters as much as the width since a return value narrower than the register is sign extended
+// for a signed type and zero extended for an unsigned one.
+//
+// # Generic Functions
+//
+// RegisterFunc only sees the type of fptr after it was instantiated, so a function type that uses type parameters
+// works like any other. A family of C functions that only differ in the element type of an argument can therefore
+// be registered by a single generic function with RegisterFuncFor:
+//
+//	func registerUniform[T int32 | float32](fn *func(location, count int32, value *T), name string) {
+//		purego.RegisterFuncFor(fn, purego.Dlsym(gl, name))
+//	}
+//
+//	registerUniform(&uniform1iv, "glUniform1iv")
+//	registerUniform(&uniform1fv, "glUniform1fv")
+//
+// # Multiple Return Values
+//
+// On amd64 and arm64 a function may return two integer values like func() (uint64, uint64).
+// The first value is read from the first integer return register and the second value from the
+// second integer return register (RAX:RDX on amd64 and X0:X1 on arm64). This makes it possible to
+// call C functions that return an unsigned __int128 (low word first) or a struct of two 64-bit integers
+// that is returned in registers. This is not supported on Windows amd64 as the value of RDX is not available.
+// The second value may also be a Carry to read the carry flag instead of the second register.
+//
+// Only some C functions set the second register, so the second value is meaningless for any other function:
+//   - functions that return an __int128 or unsigned __int128
+//   - functions that return a struct of at most 16 bytes whose second eightbyte holds integers,
+//     like ldiv_t, lldiv_t and imaxdiv_t on Linux, FreeBSD and macOS (div_t fits in the first register)
+//
+// A function may also return two float values like func() (float64, float64) which are read from the first
+// two float return registers (XMM0:XMM1 on amd64 and D0:D1 on arm64). C functions set them when they return
+// a struct of two doubles or a double _Complex, and on arm64 also a struct of two floats as func() (float32, float32).
+// This is not supported on Windows amd64 either, and two float32 values are only supported on arm64 since amd64
+// returns both floats of a struct in XMM0.
+//
+// The same values are available as r1 and r2 from SyscallN, which on 32-bit platforms are also the
+// two halves of a 64-bit integer return value (EAX:EDX on 386 and R0:R1 on arm).
+//
+// # Errno
+//
+// The second return value may be an error to follow the POSIX convention of returning -1, or NULL for a pointer,
+// and setting errno on failure. If the first value is -1 or nil the error is the syscall.Errno of errno,
+// otherwise it is nil. The first value must be a signed integer or a pointer:
+//
+//	// int close(int fd);
+//	var closeFd func(fd int32) (int32, error)
+//
+// For functions that report failure in other ways, the second return value may be a syscall.Errno instead
+// which is always the value of errno after the call. errno isn't cleared before the call so it is only meaningful
+// when the first value says that the call failed. errno is read on the thread that called the C function
+// right after it returns. This is supported on all platforms except Windows.
+//
+// # Returning Slices
+//
+// A function that returns a CSlice[T] calls a C function that returns a pointer to the first element and writes
+// the number of elements to a size_t* which is passed after the other arguments:
+//
+//	// const uint8_t *get_buffer(size_t *len);
+//	var getBuffer func() purego.CSlice[byte]
+//
+// The slice isn't copied so it points to the memory of the C function and is only valid as long as that memory is.
+// If the C function returns NULL the slice is nil. This is the same as using RegisterFuncOut with a pointer
+// and a Size to build the slice. Any other slice type except StringArray can't be returned.
+//
+// # Functions That Never Return
+//
+// A C function that never returns, like exit or abort, is declared without return values, for example
+// func(status int32) for exit. No return values are decoded for such a function so nothing
+// runs after the C call has started. Jumping out of a call with longjmp to a setjmp that was called
+// before the C function isn't supported since that would skip the Go frames of the call.
+//
+// This rules out the error handling of libraries like libpng and libjpeg, which by default longjmp from their error
+// callback to a jmp_buf that the caller set up with setjmp. setjmp can't be called through purego either since
+// the jmp_buf is only valid while the C function that called setjmp hasn't returned, and the call of setjmp returns
+// right away. A callback made by NewCallback must return to the C code that called it. Instead, install
+// error callbacks that don't longjmp where the library allows it, like png_set_error_fn with a callback that records
+// the error and returns. If the library requires a longjmp, write a small C wrapper that calls setjmp and the
+// library, and returns an error code, then call the wrapper with purego.
 //
 // # Memory
 //
@@ -81,17 +368,102 @@ func RegisterLibFunc(fptr any, handle uintptr, name string) {
 // It is then the responsibility of the caller to ensure the string stays alive as long as it's needed in C memory.
 // This can be done using runtime.KeepAlive or allocating the string in C memory using malloc. When a C function
 // returns a null-terminated pointer to char a Go string can be used. Purego will allocate a new string in Go memory
-// and copy the data over. This string will be garbage collected whenever Go decides it's no longer referenced.
+// and copy the data over on the same thread that called the function, so a string in a thread-local buffer like
+// the one returned by strerror is copied before another call can overwrite it. This string will be garbage collected whenever Go decides it's no longer referenced.
 // This C created string will not be freed by purego. If the pointer to char is not null-terminated or must continue
 // to point to C memory (because it's a buffer for example) then use a pointer to byte and then convert that to a slice
 // using unsafe.Slice. Doing this means that it becomes the responsibility of the caller to care about the lifetime
 // of the pointer
 //
+// Every argument, including the memory that pointers and slices point to, is kept alive until the C function
+// returns, even when the C function calls back into Go and the garbage collector runs during the callback.
+// Go's garbage collector doesn't move heap memory so the arguments don't need to be pinned as well.
+//
+// A C array argument like int out[16] is a pointer to its first element, so it can be declared as a slice []int32
+// or as a pointer to an array *[16]int32. Both pass the address of the first element and keep the Go memory alive
+// until the C function returns. A nil slice or pointer is passed as NULL.
+//
+// Building with the purego_cgocheck tag checks the pointer, slice and struct arguments of every call, like cgocheck
+// does for cgo, and panics if they point to Go memory that holds strings, slices, maps, channels, functions or
+// interfaces since those are always Go pointers. Pointers and unsafe.Pointers in that memory aren't reported
+// as they may point to C memory. The check isn't free so it is meant for tests and debugging.
+//
+// # Blocking Calls
+//
+// A C function is called the same way cgo calls it: runtime.cgocall on macOS, Linux and FreeBSD
+// and syscall.SyscallN on Windows. Both tell the scheduler that the goroutine left Go, so a C function
+// that blocks (sleeps, waits for a lock, does a synchronous network request, etc.) only blocks its own
+// thread and other goroutines keep running even when GOMAXPROCS is 1. There is nothing to configure
+// for long-running functions. As with cgo, each blocked call still occupies an OS thread.
+//
+// The runtime calls libc on macOS with runtime.libcCall instead, which switches to the system stack without
+// telling the scheduler. That is only correct for calls that return quickly and the linker doesn't allow packages
+// outside of the standard library to refer to it, so purego always uses runtime.cgocall. Calling a libc function
+// with cgocall is just as correct: errno and other thread-local state are read on the thread that made the call
+// (see Errno) and signals are handled the same way as for cgo.
+//
+// There is no option to call a leaf function that never calls back into Go in a lighter way. runtime.cgocall is
+// entersyscall followed by runtime.asmcgocall which switches to the system stack as C needs a bigger stack than
+// a goroutine has. Only entersyscall can be linked from outside of the standard library, and without the switch
+// the C function would run on the goroutine stack. Calling back into Go costs nothing extra for
+// functions that don't, so the same path is used for every function.
+//
+// # Floating-Point Environment
+//
+// Purego neither saves nor sets the floating-point control registers (MXCSR and the x87 control word on amd64,
+// FPCR on arm64) around a call. Go always runs with the default environment of the platform, which rounds to nearest
+// and masks all exceptions, so a C function starts with that environment. The control bits are callee-saved
+// in the C calling conventions, so a C function that changes them, for example with fesetround, must restore
+// them before it returns. Otherwise the changed rounding mode also applies to the Go code that runs afterwards
+// on the same thread.
+//
 // # Structs
 //
 // Purego can handle the most common structs that have fields of builtin types like int8, uint16, float32, etc. However,
 // it does not support aligning fields properly. It is therefore the responsibility of the caller to ensure
 // that all padding is added to the Go struct to match the C one. See `BoolStructFn` in struct_test.go for an example.
+// A struct that has a string, slice, map, channel, interface or func field can't be passed or returned by value
+// since C doesn't know the layout of these Go types and RegisterFunc panics for it. Use a pointer field to the data
+// and a separate length field instead.
+//
+// An embedded struct is placed as if its fields were written out in its place, which is the same as a nested
+// struct in C. This doesn't match a C struct that has the fields of the other struct written out if the embedded
+// struct ends in padding, since the fields that follow it start after the padding.
+//
+// A function may also return an array [N]T which is returned the same way as a struct with N fields of type T.
+//
+// A 16-byte type like the GUID of Windows is a struct that is passed by value like any other struct,
+// in two integer registers on amd64 and arm64 except on Windows amd64 where it is passed as a pointer to a copy:
+//
+//	type GUID struct {
+//		Data1 uint32
+//		Data2 uint16
+//		Data3 uint16
+//		Data4 [8]byte
+//	}
+//
+// A C array type like the uuid_t of libuuid isn't passed by value though. An array parameter is a pointer to
+// its first element in C, so it is declared as *[16]byte or []byte.
+//
+// SIMD vector types like __m128, __m256 or float32x4_t can't be passed or returned by value. They are passed
+// in a single vector register, or on the stack aligned to their size, and no Go type has that layout or an
+// alignment of more than 8 bytes. A struct like [4]float32 is passed as two float values instead. Call these
+// functions through a small C wrapper that takes a pointer to the vector and loads it with _mm_loadu_ps or similar.
+//
+// A struct that is larger than 16 bytes, like a struct stat, is returned in memory. RegisterFunc allocates
+// the memory for it and passes its address as the hidden pointer that C expects, in RDI on amd64 or X8 on arm64,
+// and the struct is read from it after the call.
+//
+// A struct that is returned in memory can also be written into a struct provided by the caller
+// by passing a pointer to it as a StructReturn in the last argument.
+//
+// On Linux amd64 structs are passed and returned by the same System V rules as on macOS amd64. A struct of
+// up to 16 bytes is returned in RAX, RDX, XMM0 and XMM1 depending on the classes of its eightbytes and
+// a larger one is written to memory that the caller passes as a hidden first argument.
+//
+// On Windows amd64 structs can only be passed as arguments. Following the Microsoft x64 calling convention,
+// a struct of 1, 2, 4 or 8 bytes is passed in a single integer register and any other struct is copied
+// and passed as a pointer to the copy.
 //
 // # Example
 //
@@ -111,29 +483,164 @@ func RegisterLibFunc(fptr any, handle uintptr, name string) {
 //
 // [Cgo rules]: https://pkg.go.dev/cmd/cgo#hdr-Go_references_to_C
 func RegisterFunc(fptr any, cfn uintptr) {
+	registerFunc(fptr, cfn, "", true)
+}
+
+// RegisterFuncFor is RegisterFunc for a pointer to a function of type F, so passing anything else
+// doesn't compile. F may use the type parameters of the generic function that calls RegisterFuncFor,
+// as shown in Generic Functions. It panics in the same cases as RegisterFunc.
+func RegisterFuncFor[F any](fptr *F, cfn uintptr) {
+	registerFunc(fptr, cfn, "", true)
+}
+
+// RegisterFuncType is RegisterFunc for a function type t that is only known at runtime, like one built
+// with reflect.FuncOf by a binding generator. It returns a function of type t that calls cfn, which can be
+// called with Call or stored with Set, instead of setting a function that fptr points to:
+//
+//	t := reflect.FuncOf([]reflect.Type{reflect.TypeOf("")}, []reflect.Type{reflect.TypeOf(int32(0))}, false)
+//	puts := purego.RegisterFuncType(t, cfn)
+//	puts.Call([]reflect.Value{reflect.ValueOf("hello")})
+//
+// It panics if t isn't a function type and otherwise in the same cases as RegisterFunc.
+func RegisterFuncType(t reflect.Type, cfn uintptr) reflect.Value {
+	if t.Kind() != reflect.Func {
+		panic("purego: t must be a function type")
+	}
+	fptr := reflect.New(t)
+	registerFunc(fptr.Interface(), cfn, "", true)
+	return fptr.Elem()
+}
+
+// registerFunc is RegisterFunc for the C function called name which is reported to the tracer.
+// If passToC is true, the function is stored in cFunctions so that it is passed to C as cfn. Internal functions
+// that are never given to the caller set it to false to skip the cost of storing them.
+func registerFunc(fptr any, cfn uintptr, name string, passToC bool) {
 	fn := reflect.ValueOf(fptr).Elem()
 	ty := fn.Type()
 	if ty.Kind() != reflect.Func {
 		panic("purego: fptr must be a function pointer")
 	}
-	if ty.NumOut() > 1 {
+	if ty.NumOut() == 1 && ty.Out(0).Implements(cSliceType) {
+		registerSliceFunc(fn, cfn, name)
+		return
+	}
+	if ty.NumOut() > 0 && ty.Out(0).Kind() == reflect.Slice && ty.Out(0) != stringArrayType {
+		panic("purego: a slice can only be returned as a CSlice or a StringArray")
+	}
+	returnsCarry := ty.NumOut() == 2 && ty.Out(1) == carryType
+	returnsErrno := ty.NumOut() == 2 && (ty.Out(1) == errorType || ty.Out(1) == errnoType)
+	returnsFloats := ty.NumOut() == 2 && isFloatPair(ty.Out(0), ty.Out(1))
+	if ty.NumOut() > 2 || ty.NumOut() == 2 && !returnsCarry && !returnsErrno && !returnsFloats && !isIntegerPair(ty.Out(0), ty.Out(1)) {
 		panic("purego: function can only return zero or one values")
 	}
+	var errnoFn uintptr
+	if returnsErrno {
+		if runtime.GOOS == "windows" {
+			panic("purego: returning errno is not supported on windows")
+		}
+		if k := ty.Out(0).Kind(); ty.Out(1) == errorType && !isSignedInteger(k) && k != reflect.Ptr && k != reflect.UnsafePointer {
+			panic("purego: error must follow a signed integer or pointer return value")
+		}
+		errnoFn = errnoLocation()
+	}
+	if ty.NumOut() == 2 && !returnsErrno && runtime.GOARCH != "arm64" && (runtime.GOARCH != "amd64" || runtime.GOOS == "windows") {
+		if returnsCarry {
+			panic("purego: Carry is only supported on amd64 & arm64 and not on windows amd64")
+		}
+		if returnsFloats {
+			panic("purego: returning two float values is only supported on amd64 & arm64")
+		}
+		panic("purego: returning two integer values is only supported on amd64 & arm64")
+	}
+	if returnsFloats && ty.Out(0).Kind() == reflect.Float32 && runtime.GOARCH != "arm64" {
+		// amd64 returns a struct of two floats packed into XMM0
+		panic("purego: returning two float32 values is only supported on arm64")
+	}
+	if returnsCarry {
+		switch k := ty.Out(0).Kind(); {
+		case isInteger(k), k == reflect.Bool, k == reflect.Ptr, k == reflect.UnsafePointer:
+		default:
+			panic("purego: Carry must follow an integer, bool or pointer return value")
+		}
+	}
+	if ty.NumOut() == 1 && ty.Out(0) == m128Type && runtime.GOARCH != "arm64" && (runtime.GOARCH != "amd64" || runtime.GOOS == "windows") {
+		panic("purego: M128 is only supported on amd64 & arm64 and not on windows amd64")
+	}
 	if cfn == 0 {
 		panic("purego: cfn is nil")
 	}
+	outStruct, returnsStruct := structOut(ty)
+	var hasStructReturn bool
+	for i := 0; i < ty.NumIn(); i++ {
+		if ty.In(i) != reflect.TypeOf(StructReturn(nil)) {
+			continue
+		}
+		if i != ty.NumIn()-1 {
+			panic("purego: StructReturn must be the last argument")
+		}
+		if returnsStruct {
+			panic("purego: StructReturn can't be used with a struct return value")
+		}
+		hasStructReturn = true
+	}
 	if ty.NumOut() == 1 && (ty.Out(0).Kind() == reflect.Float32 || ty.Out(0).Kind() == reflect.Float64) &&
 		runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" {
 		panic("purego: float returns are not supported")
 	}
+	if ty.NumOut() > 0 {
+		switch k := ty.Out(0).Kind(); k {
+		case reflect.Complex64, reflect.Complex128:
+			// fail before the call instead of after the C function already ran
+			panic("purego: complex return values are not supported")
+		case reflect.Chan, reflect.Map, reflect.Interface, reflect.Invalid:
+			panic("purego: unsupported return kind: " + k.String())
+		}
+	}
 	{
 		// this code checks how many registers and stack this function will use
 		// to avoid crashing with too many arguments
 		var ints int
 		var floats int
 		var stack int
+		// these mirror the functions that place the arguments when the function is called
+		addStack := func(uintptr) {
+			stack++
+		}
+		addInt := func(uintptr) {
+			if ints < numOfIntegerRegisters() {
+				ints++
+			} else {
+				addStack(0)
+			}
+		}
+		addFloat := func(uintptr) {
+			if floats < numOfFloats {
+				floats++
+			} else {
+				addStack(0)
+			}
+		}
+		if runtime.GOARCH != "arm64" && runtime.GOOS == "windows" {
+			// all the arguments are passed in the numbered slots on Windows
+			addFloat = addInt
+		}
+		if returnsStruct && runtime.GOARCH == "amd64" && outStruct.Size() > maxRegAllocStructSize {
+			// on amd64 if struct is bigger than 16 bytes allocate the return struct
+			// and pass it in as a hidden first argument.
+			addInt(0)
+		}
 		for i := 0; i < ty.NumIn(); i++ {
 			arg := ty.In(i)
+			if convert, ok := loadConverter(arg); ok {
+				convInts, convFloats := convert(reflect.New(arg).Elem())
+				for range convInts {
+					addInt(0)
+				}
+				for range convFloats {
+					addFloat(0)
+				}
+				continue
+			}
 			switch arg.Kind() {
 			case reflect.Func:
 				// This only does preliminary testing to ensure the CDecl argument
@@ -148,63 +655,90 @@ func RegisterFunc(fptr any, cfn uintptr) {
 						panic("purego: CDecl must be the first argument")
 					}
 				}
+				addInt(0)
 			case reflect.String, reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Ptr, reflect.UnsafePointer,
 				reflect.Slice, reflect.Bool:
-				if ints < numOfIntegerRegisters() {
-					ints++
-				} else {
-					stack++
+				if hasStructReturn && i == ty.NumIn()-1 && runtime.GOARCH == "arm64" {
+					// the struct return pointer is placed in R8
+					continue
+				}
+				if arg == reflect.TypeOf([]any(nil)) {
+					// the arguments in the slice are only known when it is called
+					continue
 				}
+				addInt(0)
+				if arg.Implements(countedType) {
+					// the length follows the pointer
+					addInt(0)
+				}
+			case reflect.Interface:
+				// the value that it holds is only known when it is called
+				addInt(0)
 			case reflect.Float32, reflect.Float64:
 				const is32bit = unsafe.Sizeof(uintptr(0)) == 4
 				if is32bit {
 					panic("purego: floats only supported on 64bit platforms")
 				}
-				if floats < numOfFloats {
-					floats++
-				} else {
-					stack++
-				}
+				addFloat(0)
 			case reflect.Struct:
-				if runtime.GOOS != "darwin" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
-					panic("purego: struct arguments are only supported on darwin amd64 & arm64")
-				}
+				checkStructArgsSupported()
 				if arg.Size() == 0 {
 					continue
 				}
-				addInt := func(u uintptr) {
-					ints++
-				}
-				addFloat := func(u uintptr) {
-					floats++
-				}
-				addStack := func(u uintptr) {
-					stack++
-				}
+				checkStructFieldsSupported(arg)
 				_ = addStruct(reflect.New(arg).Elem(), &ints, &floats, &stack, addInt, addFloat, addStack, nil)
 			default:
 				panic("purego: unsupported kind " + arg.Kind().String())
 			}
 		}
-		if ty.NumOut() == 1 && ty.Out(0).Kind() == reflect.Struct {
-			if runtime.GOOS != "darwin" {
-				panic("purego: struct return values only supported on darwin arm64 & amd64")
-			}
-			outType := ty.Out(0)
-			checkStructFieldsSupported(outType)
-			if runtime.GOARCH == "amd64" && outType.Size() > maxRegAllocStructSize {
-				// on amd64 if struct is bigger than 16 bytes allocate the return struct
-				// and pass it in as a hidden first argument.
-				ints++
+		if returnsStruct {
+			if runtime.GOOS != "darwin" && !(runtime.GOOS == "linux" && runtime.GOARCH == "amd64") {
+				panic("purego: struct return values only supported on darwin arm64 & amd64 and linux amd64")
 			}
+			checkStructFieldsSupported(outStruct)
 		}
 		sizeOfStack := maxArgs - numOfIntegerRegisters()
 		if stack > sizeOfStack {
 			panic("purego: too many arguments")
 		}
 	}
+	if fast, ok := fastFunc(ty, cfn, name); ok {
+		fn.Set(fast)
+		if passToC {
+			storeCFunction(fast, cfn)
+		}
+		return
+	}
+	// A returned string may point to a thread-local buffer like the ones of strerror and dlerror
+	// which is only valid on the thread that called the function until it calls it again.
+	// Stay on that thread until the string has been copied so no other goroutine can run there in between.
+	returnsString := ty.NumOut() == 1 && ty.Out(0).Kind() == reflect.String
+	if ty.NumIn() == 0 && !returnsStruct {
+		// A function without arguments doesn't need any of the register and stack placement
+		// so only the call and the conversion of the return values are left.
+		// The ones that return a builtin integer type don't even get here since fastFunc handles them.
+		fn.Set(reflect.MakeFunc(ty, func(args []reflect.Value) (results []reflect.Value) {
+			if returnsString {
+				runtime.LockOSThread()
+				defer runtime.UnlockOSThread()
+			}
+			syscall := thePool.Get().(*syscall15Args)
+			defer thePool.Put(syscall)
+			*syscall = syscall15Args{fn: cfn, errno: errnoFn}
+			callTraced(name, syscall)
+			return returnValues(ty, outStruct, syscall, args)
+		}))
+		if passToC {
+			storeCFunction(fn, cfn)
+		}
+		return
+	}
 	v := reflect.MakeFunc(ty, func(args []reflect.Value) (results []reflect.Value) {
+		if returnsString {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+		}
 		var sysargs [maxArgs]uintptr
 		stack := sysargs[numOfIntegerRegisters():]
 		var floats [numOfFloats]uintptr
@@ -215,6 +749,9 @@ func RegisterFunc(fptr any, cfn uintptr) {
 		if runtime.GOARCH == "arm64" || runtime.GOOS != "windows" {
 			// Windows arm64 uses the same calling convention as macOS and Linux
 			addStack = func(x uintptr) {
+				if numStack >= len(stack) {
+					panic("purego: too many arguments")
+				}
 				stack[numStack] = x
 				numStack++
 			}
@@ -241,6 +778,9 @@ func RegisterFunc(fptr any, cfn uintptr) {
 			// This is in contrast to how macOS and Linux pass arguments which
 			// tries to use as many registers as possible in the calling convention.
 			addStack = func(x uintptr) {
+				if numStack >= len(sysargs) {
+					panic("purego: too many arguments")
+				}
 				sysargs[numStack] = x
 				numStack++
 			}
@@ -250,111 +790,380 @@ func RegisterFunc(fptr any, cfn uintptr) {
 
 		var keepAlive []any
 		defer func() {
+			for _, v := range keepAlive {
+				if release, ok := v.(cRelease); ok {
+					release()
+				}
+			}
 			runtime.KeepAlive(keepAlive)
 			runtime.KeepAlive(args)
 		}()
 
 		var arm64_r8 uintptr
-		if ty.NumOut() == 1 && ty.Out(0).Kind() == reflect.Struct {
-			outType := ty.Out(0)
-			if runtime.GOARCH == "amd64" && outType.Size() > maxRegAllocStructSize {
-				val := reflect.New(outType)
+		if returnsStruct {
+			if runtime.GOARCH == "amd64" && outStruct.Size() > maxRegAllocStructSize {
+				val := reflect.New(outStruct)
 				keepAlive = append(keepAlive, val)
 				addInt(val.Pointer())
-			} else if runtime.GOARCH == "arm64" && outType.Size() > maxRegAllocStructSize {
-				isAllFloats, numFields := isAllSameFloat(outType)
+			} else if runtime.GOARCH == "arm64" && outStruct.Size() > maxRegAllocStructSize {
+				isAllFloats, numFields := isAllSameFloat(outStruct)
 				if !isAllFloats || numFields > 4 {
-					val := reflect.New(outType)
+					val := reflect.New(outStruct)
 					keepAlive = append(keepAlive, val)
 					arm64_r8 = val.Pointer()
 				}
 			}
 		}
+		if hasStructReturn {
+			ptr := args[len(args)-1].Pointer()
+			if runtime.GOARCH == "arm64" {
+				arm64_r8 = ptr
+			} else {
+				addInt(ptr)
+			}
+			args = args[:len(args)-1]
+		}
 		for i, v := range args {
 			if variadic, ok := args[i].Interface().([]any); ok {
 				if i != len(args)-1 {
 					panic("purego: can only expand last parameter")
 				}
 				for _, x := range variadic {
+					if cgocheck {
+						checkGoPointers(i, reflect.ValueOf(x))
+					}
 					keepAlive = addValue(reflect.ValueOf(x), keepAlive, addInt, addFloat, addStack, &numInts, &numFloats, &numStack)
 				}
 				continue
 			}
+			if cgocheck {
+				checkGoPointers(i, v)
+			}
 			keepAlive = addValue(v, keepAlive, addInt, addFloat, addStack, &numInts, &numFloats, &numStack)
 		}
 
 		syscall := thePool.Get().(*syscall15Args)
 		defer thePool.Put(syscall)
 
-		if runtime.GOARCH == "arm64" || runtime.GOOS != "windows" {
-			// Use the normal arm64 calling convention even on Windows
-			*syscall = syscall15Args{
-				cfn,
-				sysargs[0], sysargs[1], sysargs[2], sysargs[3], sysargs[4], sysargs[5],
-				sysargs[6], sysargs[7], sysargs[8], sysargs[9], sysargs[10], sysargs[11],
-				sysargs[12], sysargs[13], sysargs[14],
-				floats[0], floats[1], floats[2], floats[3], floats[4], floats[5], floats[6], floats[7],
-				arm64_r8,
+		*syscall = syscall15Args{
+			cfn,
+			sysargs[0], sysargs[1], sysargs[2], sysargs[3], sysargs[4], sysargs[5],
+			sysargs[6], sysargs[7], sysargs[8], sysargs[9], sysargs[10], sysargs[11],
+			sysargs[12], sysargs[13], sysargs[14],
+			floats[0], floats[1], floats[2], floats[3], floats[4], floats[5], floats[6], floats[7],
+			arm64_r8, 0, errnoFn,
+		}
+		callTraced(name, syscall)
+		return returnValues(ty, outStruct, syscall, args)
+	})
+	fn.Set(v)
+	if passToC {
+		storeCFunction(v, cfn)
+	}
+}
+
+// fastFunc returns a function of type ty that calls cfn without reflect.MakeFunc if ty is one of the signatures
+// that most bindings are made of. Converting the arguments and results of these functions is trivial, so
+// the cost of calling a function made by reflect.MakeFunc would be most of the cost of calling them.
+// It reports false for all other signatures, a converter registered for an argument type and the cgocheck build.
+func fastFunc(ty reflect.Type, cfn uintptr, name string) (reflect.Value, bool) {
+	if cgocheck {
+		return reflect.Value{}, false
+	}
+	for i := 0; i < ty.NumIn(); i++ {
+		if _, ok := loadConverter(ty.In(i)); ok {
+			return reflect.Value{}, false
+		}
+	}
+	call := func(a1, a2 uintptr) uintptr {
+		syscall := thePool.Get().(*syscall15Args)
+		*syscall = syscall15Args{fn: cfn, a1: a1, a2: a2}
+		callTraced(name, syscall)
+		r1 := syscall.a1
+		thePool.Put(syscall)
+		return r1
+	}
+	var fn any
+	switch ty {
+	case reflect.TypeOf(func() {}):
+		fn = func() { call(0, 0) }
+	case reflect.TypeOf(func() uintptr { return 0 }):
+		fn = func() uintptr { return call(0, 0) }
+	case reflect.TypeOf(func() int { return 0 }):
+		fn = func() int { return int(call(0, 0)) }
+	case reflect.TypeOf(func() int32 { return 0 }):
+		fn = func() int32 { return int32(call(0, 0)) }
+	case reflect.TypeOf(func() uint32 { return 0 }):
+		fn = func() uint32 { return uint32(call(0, 0)) }
+	case reflect.TypeOf(func() int64 { return 0 }):
+		fn = func() int64 { return int64(call(0, 0)) }
+	case reflect.TypeOf(func() uint64 { return 0 }):
+		fn = func() uint64 { return uint64(call(0, 0)) }
+	case reflect.TypeOf(func() bool { return false }):
+		fn = func() bool { return byte(call(0, 0)) != 0 }
+	case reflect.TypeOf(func() unsafe.Pointer { return nil }):
+		fn = func() unsafe.Pointer {
+			r1 := call(0, 0)
+			// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+			return *(*unsafe.Pointer)(unsafe.Pointer(&r1))
+		}
+	case reflect.TypeOf(func(uintptr) {}):
+		fn = func(a1 uintptr) { call(a1, 0) }
+	case reflect.TypeOf(func(uintptr) uintptr { return 0 }):
+		fn = func(a1 uintptr) uintptr { return call(a1, 0) }
+	case reflect.TypeOf(func(uintptr, uintptr) uintptr { return 0 }):
+		fn = func(a1, a2 uintptr) uintptr { return call(a1, a2) }
+	case reflect.TypeOf(func(string) uintptr { return 0 }):
+		fn = func(s string) uintptr {
+			ptr := strings.CString(s)
+			defer runtime.KeepAlive(ptr)
+			return call(uintptr(unsafe.Pointer(ptr)), 0)
+		}
+	default:
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(fn), true
+}
+
+// cFunctions maps the address of the closure of each function that registerFunc created to the C function
+// that it calls. Such a function is passed to C as the C function instead of as a callback that calls it.
+var cFunctions sync.Map // map[uintptr]uintptr
+
+// storeCFunction records that the function fn made by reflect.MakeFunc calls the C function cfn.
+// The entry is removed when fn is garbage collected so that registering functions over and over doesn't leak.
+// The store and the finalizer are about as expensive as the rest of a registration, so it is skipped
+// for the functions that can't be passed to C.
+func storeCFunction(fn reflect.Value, cfn uintptr) {
+	closure := closureOf(fn)
+	cFunctions.Store(uintptr(closure), cfn)
+	// The finalizer only gets the address so that it doesn't keep the closure alive. The closure is freed after
+	// the finalizer ran which is why another closure can't get the address while it is still in cFunctions.
+	runtime.SetFinalizer((*byte)(closure), func(p *byte) {
+		cFunctions.Delete(uintptr(unsafe.Pointer(p)))
+	})
+}
+
+// closureOf returns the pointer to the closure of the func fn which is different for every function made by
+// reflect.MakeFunc unlike fn.Pointer which is the same code for all of them.
+func closureOf(fn reflect.Value) unsafe.Pointer {
+	ptr := reflect.New(fn.Type())
+	ptr.Elem().Set(fn)
+	return *(*unsafe.Pointer)(ptr.UnsafePointer())
+}
+
+type cFuncKey struct {
+	typ reflect.Type
+	cfn uintptr
+}
+
+// cFuncs caches the functions returned by cFunc so that a C function that is returned again
+// isn't registered again.
+var cFuncs sync.Map // map[cFuncKey]reflect.Value
+
+// cFunc returns a function of type ty that calls the C function cfn.
+func cFunc(ty reflect.Type, cfn uintptr) reflect.Value {
+	key := cFuncKey{ty, cfn}
+	if fn, ok := cFuncs.Load(key); ok {
+		return fn.(reflect.Value)
+	}
+	fn := reflect.New(ty)
+	RegisterFunc(fn.Interface(), cfn)
+	actual, _ := cFuncs.LoadOrStore(key, fn.Elem())
+	return actual.(reflect.Value)
+}
+
+// callTraced is callSyscall15X that reports the call to the tracer set by SetTracer.
+func callTraced(name string, syscall *syscall15Args) {
+	trace, _ := tracer.Load().(func(name string, args []uintptr, ret uintptr))
+	if trace == nil {
+		callSyscall15X(syscall)
+		return
+	}
+	args := []uintptr{
+		syscall.a1, syscall.a2, syscall.a3, syscall.a4, syscall.a5, syscall.a6, syscall.a7, syscall.a8,
+		syscall.a9, syscall.a10, syscall.a11, syscall.a12, syscall.a13, syscall.a14, syscall.a15,
+		syscall.f1, syscall.f2, syscall.f3, syscall.f4, syscall.f5, syscall.f6, syscall.f7, syscall.f8,
+	}
+	callSyscall15X(syscall)
+	trace(name, args, syscall.a1)
+}
+
+// callSyscall15X calls the C function syscall.fn with the arguments stored in syscall.
+// The return values are placed back into syscall.a1, syscall.a2 and the float registers.
+func callSyscall15X(syscall *syscall15Args) {
+	if runtime.GOARCH == "arm64" || runtime.GOOS != "windows" {
+		// Use the normal arm64 calling convention even on Windows
+		runtime_cgocall(syscall15XABI0, unsafe.Pointer(syscall))
+		return
+	}
+	// This is a fallback for Windows amd64, 386, and arm. Note this may not support floats
+	r1, r2, _ := syscall_syscall15X(syscall.fn, syscall.a1, syscall.a2, syscall.a3, syscall.a4, syscall.a5,
+		syscall.a6, syscall.a7, syscall.a8, syscall.a9, syscall.a10, syscall.a11, syscall.a12,
+		syscall.a13, syscall.a14, syscall.a15)
+	*syscall = syscall15Args{a1: r1, a2: r2}
+	syscall.f1 = syscall.a2 // on amd64 a2 stores the float return. On 32bit platforms floats aren't support
+}
+
+// returnValues converts the return registers stored in syscall into the results of a function of type ty.
+// The args slice is reused for the results when possible to avoid an allocation.
+func returnValues(ty reflect.Type, outStruct reflect.Type, syscall *syscall15Args, args []reflect.Value) []reflect.Value {
+	if ty.NumOut() == 0 {
+		// the return registers of a function called only for its side effects are ignored
+		// without allocating anything
+		return nil
+	}
+	outType := ty.Out(0)
+	v := reflect.New(outType).Elem()
+	switch outType.Kind() {
+	case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(syscall.a1))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(syscall.a1))
+	case reflect.Bool:
+		v.SetBool(byte(syscall.a1) != 0)
+	case reflect.UnsafePointer:
+		// We take the address and then dereference it to trick go vet from creating a possible miss-use of unsafe.Pointer
+		v.SetPointer(*(*unsafe.Pointer)(unsafe.Pointer(&syscall.a1)))
+	case reflect.Ptr:
+		v = reflect.NewAt(outType, unsafe.Pointer(&syscall.a1)).Elem()
+	case reflect.Func:
+		// wrap this C function in a nicely typed Go function, a NULL function pointer stays a nil func
+		if syscall.a1 != 0 {
+			v.Set(cFunc(outType, syscall.a1))
+		}
+	case reflect.String:
+		if outType == wstringType {
+			v.SetString(GoWString(*(**WChar)(unsafe.Pointer(&syscall.a1))))
+			break
+		}
+		v.SetString(strings.GoString(syscall.a1))
+	case reflect.Float32:
+		// NOTE: syscall.r2 is only the floating return value on 64bit platforms.
+		// On 32bit platforms syscall.r2 is the upper part of a 64bit return.
+		v.SetFloat(float64(math.Float32frombits(uint32(syscall.f1))))
+	case reflect.Float64:
+		// NOTE: syscall.r2 is only the floating return value on 64bit platforms.
+		// On 32bit platforms syscall.r2 is the upper part of a 64bit return.
+		v.SetFloat(math.Float64frombits(uint64(syscall.f1)))
+	case reflect.Slice:
+		// only a StringArray gets here since other slices are built from an out-parameter
+		v.Set(reflect.ValueOf(StringArray(GoStrings(syscall.a1))))
+	case reflect.Struct:
+		v = getStruct(outType, *syscall)
+	case reflect.Array:
+		if outType == m128Type {
+			// the trampoline saves the upper half of the vector register in f5
+			*(*[2]uintptr)(v.Addr().UnsafePointer()) = [2]uintptr{syscall.f1, syscall.f5}
+			break
+		}
+		// the array has the same layout as outStruct so copy the struct into it
+		v = reflect.New(outType)
+		reflect.NewAt(outStruct, v.UnsafePointer()).Elem().Set(getStruct(outStruct, *syscall))
+		v = v.Elem()
+	default:
+		panic("purego: unsupported return kind: " + outType.Kind().String())
+	}
+	if ty.NumOut() == 2 {
+		v2 := reflect.New(ty.Out(1)).Elem()
+		switch ty.Out(1) {
+		case carryType:
+			v2.SetBool(carrySet(syscall.flags))
+		case errnoType:
+			v2.SetUint(uint64(syscall.errno))
+		case errorType:
+			// errno is only meaningful if the return value says that the call failed
+			if k := outType.Kind(); isSignedInteger(k) && v.Int() == -1 || !isSignedInteger(k) && v.IsNil() {
+				errno := reflect.New(errnoType).Elem()
+				errno.SetUint(uint64(syscall.errno))
+				v2.Set(errno)
 			}
-			runtime_cgocall(syscall15XABI0, unsafe.Pointer(syscall))
-		} else {
-			*syscall = syscall15Args{}
-			// This is a fallback for Windows amd64, 386, and arm. Note this may not support floats
-			syscall.a1, syscall.a2, _ = syscall_syscall15X(cfn, sysargs[0], sysargs[1], sysargs[2], sysargs[3], sysargs[4],
-				sysargs[5], sysargs[6], sysargs[7], sysargs[8], sysargs[9], sysargs[10], sysargs[11],
-				sysargs[12], sysargs[13], sysargs[14])
-			syscall.f1 = syscall.a2 // on amd64 a2 stores the float return. On 32bit platforms floats aren't support
-		}
-		if ty.NumOut() == 0 {
-			return nil
-		}
-		outType := ty.Out(0)
-		v := reflect.New(outType).Elem()
-		switch outType.Kind() {
-		case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			v.SetUint(uint64(syscall.a1))
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			v.SetInt(int64(syscall.a1))
-		case reflect.Bool:
-			v.SetBool(byte(syscall.a1) != 0)
-		case reflect.UnsafePointer:
-			// We take the address and then dereference it to trick go vet from creating a possible miss-use of unsafe.Pointer
-			v.SetPointer(*(*unsafe.Pointer)(unsafe.Pointer(&syscall.a1)))
-		case reflect.Ptr:
-			v = reflect.NewAt(outType, unsafe.Pointer(&syscall.a1)).Elem()
-		case reflect.Func:
-			// wrap this C function in a nicely typed Go function
-			v = reflect.New(outType)
-			RegisterFunc(v.Interface(), syscall.a1)
-		case reflect.String:
-			v.SetString(strings.GoString(syscall.a1))
-		case reflect.Float32:
-			// NOTE: syscall.r2 is only the floating return value on 64bit platforms.
-			// On 32bit platforms syscall.r2 is the upper part of a 64bit return.
-			v.SetFloat(float64(math.Float32frombits(uint32(syscall.f1))))
-		case reflect.Float64:
-			// NOTE: syscall.r2 is only the floating return value on 64bit platforms.
-			// On 32bit platforms syscall.r2 is the upper part of a 64bit return.
-			v.SetFloat(math.Float64frombits(uint64(syscall.f1)))
-		case reflect.Struct:
-			v = getStruct(outType, *syscall)
 		default:
-			panic("purego: unsupported return kind: " + outType.Kind().String())
+			switch ty.Out(1).Kind() {
+			case reflect.Float32:
+				// the second float value is placed in the second float return register
+				v2.SetFloat(float64(math.Float32frombits(uint32(syscall.f2))))
+			case reflect.Float64:
+				v2.SetFloat(math.Float64frombits(uint64(syscall.f2)))
+			default:
+				// the second integer value is placed in the second return register
+				setInteger(v2, syscall.a2)
+			}
 		}
-		if len(args) > 0 {
-			// reuse args slice instead of allocating one when possible
-			args[0] = v
-			return args[:1]
-		} else {
-			return []reflect.Value{v}
+		if len(args) > 1 {
+			args[0], args[1] = v, v2
+			return args[:2]
 		}
-	})
-	fn.Set(v)
+		return []reflect.Value{v, v2}
+	}
+	if len(args) > 0 {
+		// reuse args slice instead of allocating one when possible
+		args[0] = v
+		return args[:1]
+	} else {
+		return []reflect.Value{v}
+	}
 }
 
+// ToUintptr converts v to the value that RegisterFunc passes to a C function for an argument of its type,
+// for code that calls SyscallN directly. For example, a string is copied into a null-terminated C string unless it
+// already ends in \x00 and the result is the pointer to it, a bool is 0 or 1, and a float is its IEEE 754 bits
+// in which case isFloat is true since it belongs in a float register. A nil v is 0.
+//
+//	s, _, keepAlive := purego.ToUintptr("hello")
+//	n, _, _ := purego.SyscallN(strlen, s)
+//	runtime.KeepAlive(keepAlive)
+//
+// The memory that val points to is only valid while keepAlive is reachable, so keepAlive must be kept alive
+// until the C function returns. It panics if v is a kind that RegisterFunc doesn't support or if it isn't passed
+// as a single value, like a struct or a Counted, or if it is a StringArray which needs CStringArray instead.
+func ToUintptr(v any) (val uintptr, isFloat bool, keepAlive any) {
+	if v == nil {
+		return 0, false, nil
+	}
+	var vals []uintptr
+	var floats []bool
+	addInt := func(x uintptr) {
+		vals = append(vals, x)
+		floats = append(floats, false)
+	}
+	addFloat := func(x uintptr) {
+		vals = append(vals, x)
+		floats = append(floats, true)
+	}
+	if _, ok := v.(StringArray); ok {
+		// the C memory of the array would never be freed
+		panic("purego: use CStringArray to pass a StringArray to SyscallN")
+	}
+	var numInts, numFloats, numStack int
+	keep := addValue(reflect.ValueOf(v), []any{v}, addInt, addFloat, addInt, &numInts, &numFloats, &numStack)
+	if len(vals) != 1 {
+		panic("purego: " + reflect.TypeOf(v).String() + " isn't passed as a single value")
+	}
+	return vals[0], floats[0], keep
+}
+
+// cRelease is a function in the keepAlive values of a call that frees C memory made for the call after it returns.
+type cRelease func()
+
 func addValue(v reflect.Value, keepAlive []any, addInt func(x uintptr), addFloat func(x uintptr), addStack func(x uintptr), numInts *int, numFloats *int, numStack *int) []any {
+	if convert, ok := loadConverter(v.Type()); ok {
+		ints, floats := convert(v)
+		for _, x := range ints {
+			addInt(x)
+		}
+		for _, x := range floats {
+			addFloat(x)
+		}
+		return keepAlive
+	}
 	switch v.Kind() {
 	case reflect.String:
+		if v.Type() == wstringType {
+			ptr := WCharPtr(v.String())
+			keepAlive = append(keepAlive, ptr)
+			addInt(uintptr(unsafe.Pointer(ptr)))
+			break
+		}
 		ptr := strings.CString(v.String())
 		keepAlive = append(keepAlive, ptr)
 		addInt(uintptr(unsafe.Pointer(ptr)))
@@ -363,9 +1172,27 @@ func addValue(v reflect.Value, keepAlive []any, addInt func(x uintptr), addFloat
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		addInt(uintptr(v.Int()))
 	case reflect.Ptr, reflect.UnsafePointer, reflect.Slice:
+		if v.Type() == stringArrayType {
+			// the array is released after the call by the deferred function of the call
+			ptr, release := CStringArray(v.Interface().(StringArray))
+			keepAlive = append(keepAlive, cRelease(release))
+			addInt(uintptr(unsafe.Pointer(ptr)))
+			break
+		}
 		// There is no need to keepAlive this pointer separately because it is kept alive in the args variable
+		if v.Type().Implements(countedType) {
+			ptr, n := v.Interface().(counted).counted()
+			addInt(ptr)
+			addInt(n)
+			break
+		}
 		addInt(v.Pointer())
 	case reflect.Func:
+		// a function that calls a C function is passed as that C function
+		if cfn, ok := cFunctions.Load(uintptr(closureOf(v))); ok {
+			addInt(cfn.(uintptr))
+			break
+		}
 		addInt(NewCallback(v.Interface()))
 	case reflect.Bool:
 		if v.Bool() {
@@ -379,6 +1206,13 @@ func addValue(v reflect.Value, keepAlive []any, addInt func(x uintptr), addFloat
 		addFloat(uintptr(math.Float64bits(v.Float())))
 	case reflect.Struct:
 		keepAlive = addStruct(v, numInts, numFloats, numStack, addInt, addFloat, addStack, keepAlive)
+	case reflect.Interface:
+		if v.IsNil() {
+			addInt(0)
+			break
+		}
+		// pass the value that the interface holds
+		keepAlive = addValue(v.Elem(), keepAlive, addInt, addFloat, addStack, numInts, numFloats, numStack)
 	default:
 		panic("purego: unsupported kind: " + v.Kind().String())
 	}
@@ -393,54 +1227,109 @@ func addValue(v reflect.Value, keepAlive []any, addInt func(x uintptr), addFloat
 const maxRegAllocStructSize = 16
 
 func isAllSameFloat(ty reflect.Type) (allFloats bool, numFields int) {
-	allFloats = true
-	root := ty.Field(0).Type
-	for root.Kind() == reflect.Struct {
-		root = root.Field(0).Type
-	}
-	first := root.Kind()
-	if first != reflect.Float32 && first != reflect.Float64 {
-		allFloats = false
-	}
-	for i := 0; i < ty.NumField(); i++ {
-		f := ty.Field(i).Type
-		if f.Kind() == reflect.Struct {
-			var structNumFields int
-			allFloats, structNumFields = isAllSameFloat(f)
-			numFields += structNumFields
-			continue
-		}
-		numFields++
-		if f.Kind() != first {
+	fields := structFields(ty)
+	if len(fields) == 0 {
+		return false, 0
+	}
+	first := fields[0].typ.Kind()
+	allFloats = first == reflect.Float32 || first == reflect.Float64
+	for _, f := range fields {
+		if f.typ.Kind() != first {
 			allFloats = false
 		}
 	}
-	return allFloats, numFields
+	return allFloats, len(fields)
 }
 
 func checkStructFieldsSupported(ty reflect.Type) {
-	for i := 0; i < ty.NumField(); i++ {
-		f := ty.Field(i).Type
-		if f.Kind() == reflect.Array {
-			f = f.Elem()
-		} else if f.Kind() == reflect.Struct {
-			checkStructFieldsSupported(f)
-			continue
-		}
-		switch f.Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+	for _, f := range structFields(ty) {
+		switch f.typ.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 			reflect.Uintptr, reflect.Ptr, reflect.UnsafePointer, reflect.Float64, reflect.Float32:
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Chan, reflect.Interface, reflect.Func:
+			// the headers of these types only exist in Go so C can't read them
+			panic(fmt.Sprintf("purego: struct field type %s can't be passed by value to or from C; use a pointer field instead", f.typ))
 		default:
-			panic(fmt.Sprintf("purego: struct field type %s is not supported", f))
+			panic(fmt.Sprintf("purego: struct field type %s is not supported", f.typ))
 		}
 	}
 }
 
+// structOut returns the struct type that the return value of the function type ty is decoded as.
+// An array [N]T is returned like a struct with N fields of type T.
+func structOut(ty reflect.Type) (reflect.Type, bool) {
+	if ty.NumOut() != 1 {
+		return nil, false
+	}
+	switch out := ty.Out(0); out.Kind() {
+	case reflect.Struct:
+		return out, true
+	case reflect.Array:
+		if out == m128Type {
+			// a vector is returned in a single register and not like a struct
+			return nil, false
+		}
+		fields := make([]reflect.StructField, out.Len())
+		for i := range fields {
+			fields[i] = reflect.StructField{Name: "F" + strconv.Itoa(i), Type: out.Elem()}
+		}
+		return reflect.StructOf(fields), true
+	}
+	return nil, false
+}
+
+// isIntegerPair reports whether both types are integers and can therefore
+// be returned in the first and second integer return registers.
+func isIntegerPair(t1, t2 reflect.Type) bool {
+	return isInteger(t1.Kind()) && isInteger(t2.Kind())
+}
+
+// isFloatPair reports whether t1 and t2 are both float32 or both float64.
+func isFloatPair(t1, t2 reflect.Type) bool {
+	k := t1.Kind()
+	return (k == reflect.Float32 || k == reflect.Float64) && t2.Kind() == k
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isSignedInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// setInteger sets v which must be an integer kind to the value of the register r.
+func setInteger(v reflect.Value, r uintptr) {
+	switch v.Kind() {
+	case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(r))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(r))
+	}
+}
+
 func roundUpTo8(val uintptr) uintptr {
 	return (val + 7) &^ 7
 }
 
+// checkStructArgsSupported panics if structs can't be passed as arguments on this platform.
+func checkStructArgsSupported() {
+	if !(runtime.GOOS == "darwin" && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64")) &&
+		!((runtime.GOOS == "linux" || runtime.GOOS == "windows") && runtime.GOARCH == "amd64") {
+		panic("purego: struct arguments are only supported on darwin amd64 & arm64 and linux & windows amd64")
+	}
+}
+
 func numOfIntegerRegisters() int {
 	switch runtime.GOARCH {
 	case "arm64":
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestStdcallName(t *testing.T) {
+	type point struct {
+		X, Y int32
+	}
+	type rgb struct {
+		R, G, B uint8
+	}
+	tests := []struct {
+		fptr any
+		name string // empty if there is no decorated name
+	}{
+		{fptr: new(func()), name: "_F@0"},
+		{fptr: new(func(int32, uint16, int8, bool) int32), name: "_F@16"},
+		{fptr: new(func(int, uintptr, *byte, unsafe.Pointer)), name: "_F@16"},
+		{fptr: new(func(float32, float64)), name: "_F@12"},
+		{fptr: new(func(int64, uint64)), name: "_F@16"},
+		{fptr: new(func(point, rgb)), name: "_F@12"},
+		{fptr: new(func(string, []byte, func())), name: "_F@12"},
+		{fptr: new(func(Counted[float64], int32)), name: "_F@12"},
+		{fptr: new(func(CDecl, int32))},
+		{fptr: new(func(string, ...any))},
+		{fptr: new(func(any))},
+		{fptr: func() {}},
+	}
+	for _, test := range tests {
+		ty := reflect.TypeOf(test.fptr)
+		name, ok := stdcallName("F", ty, 4)
+		if want := test.name != ""; ok != want || name != test.name {
+			t.Errorf("stdcallName(%q, %v) = %q, %v; want %q, %v", "F", ty, name, ok, test.name, want)
+		}
+	}
+}
+
+func TestStdcallName_outParameters(t *testing.T) {
+	// void get_size(int id, int *w, int *h) has 12 bytes of arguments
+	ty := reflect.PointerTo(outFuncType(reflect.TypeOf(func(int32) (w, h int32) { return 0, 0 }), 2))
+	if name, ok := stdcallName("get_size", ty, 4); !ok || name != "_get_size@12" {
+		t.Errorf("stdcallName(%q, %v) = %q, %v; want %q, true", "get_size", ty, name, ok, "_get_size@12")
+	}
+}
@@ -5,8 +5,15 @@ package purego_test
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/ebitengine/purego"
@@ -71,6 +78,40 @@ func Test_qsort(t *testing.T) {
 	}
 }
 
+func TestRegisterFunc_argumentsAliveDuringCallback(t *testing.T) {
+	if runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" {
+		t.Skip("Platform doesn't support callbacks")
+		return
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+
+	var freed int32
+	newData := func() *[5]int {
+		data := &[5]int{88, 56, 100, 2, 25}
+		runtime.SetFinalizer(data, func(*[5]int) { atomic.StoreInt32(&freed, 1) })
+		return data
+	}
+	compare := func(_ purego.CDecl, a, b *int) int {
+		// the array is only referenced by the argument of qsort
+		runtime.GC()
+		runtime.GC()
+		if atomic.LoadInt32(&freed) != 0 {
+			t.Errorf("the array passed to qsort was freed during the call")
+		}
+		return *a - *b
+	}
+	var qsort func(data *[5]int, nitms uintptr, size uintptr, compar func(_ purego.CDecl, a, b *int) int)
+	purego.RegisterLibFunc(&qsort, libc, "qsort")
+	qsort(newData(), 5, unsafe.Sizeof(int(0)), compare)
+}
+
 func TestRegisterFunc_Floats(t *testing.T) {
 	if runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" {
 		t.Skip("Platform doesn't support Floats")
@@ -128,3 +169,818 @@ func TestRegisterLibFunc_Bool(t *testing.T) {
 		t.Errorf("runFalse failed. got %t but wanted %t", got, expected)
 	}
 }
+
+func BenchmarkRegisterFunc_zeroArguments(b *testing.B) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		b.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		b.Fatalf("failed to dlopen: %s", err)
+	}
+	// func() int32 is one of the signatures that aren't made by reflect.MakeFunc
+	var rand func() int32
+	purego.RegisterLibFunc(&rand, libc, "rand")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rand()
+	}
+}
+
+// BenchmarkRegisterFunc_zeroArgumentsMakeFunc is the baseline of BenchmarkRegisterFunc_zeroArguments
+// for a result type that needs reflect.MakeFunc.
+func BenchmarkRegisterFunc_zeroArgumentsMakeFunc(b *testing.B) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		b.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		b.Fatalf("failed to dlopen: %s", err)
+	}
+	type result int32
+	var rand func() result
+	purego.RegisterLibFunc(&rand, libc, "rand")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rand()
+	}
+}
+
+func BenchmarkRegisterFunc_commonSignature(b *testing.B) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		b.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		b.Fatalf("failed to dlopen: %s", err)
+	}
+	// func(string) uintptr is one of the signatures that aren't made by reflect.MakeFunc
+	var strlen func(s string) uintptr
+	purego.RegisterLibFunc(&strlen, libc, "strlen")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		strlen("purego\x00")
+	}
+}
+
+// TestRegisterFunc_commonSignatures checks the functions of the signatures that don't use reflect.MakeFunc.
+func TestRegisterFunc_commonSignatures(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var strlen func(s string) uintptr
+	purego.RegisterLibFunc(&strlen, libc, "strlen")
+	if got := strlen("purego"); got != 6 {
+		t.Errorf("strlen returned %d wanted %d", got, 6)
+	}
+	var strlenPtr func(s uintptr) uintptr
+	purego.RegisterLibFunc(&strlenPtr, libc, "strlen")
+	s := []byte("purego\x00")
+	if got := strlenPtr(uintptr(unsafe.Pointer(&s[0]))); got != 6 {
+		t.Errorf("strlen returned %d wanted %d", got, 6)
+	}
+	runtime.KeepAlive(s)
+
+	var malloc func(size uintptr) uintptr
+	var free func(ptr uintptr)
+	var calloc func(n, size uintptr) uintptr
+	purego.RegisterLibFunc(&malloc, libc, "malloc")
+	purego.RegisterLibFunc(&free, libc, "free")
+	purego.RegisterLibFunc(&calloc, libc, "calloc")
+	ptr := calloc(4, 8)
+	if ptr == 0 {
+		t.Fatal("calloc returned NULL")
+	}
+	if got := *(*[4]uint64)(*(*unsafe.Pointer)(unsafe.Pointer(&ptr))); got != [4]uint64{} {
+		t.Errorf("calloc returned memory with %v wanted zeros", got)
+	}
+	free(ptr)
+	if ptr := malloc(16); ptr == 0 {
+		t.Error("malloc returned NULL")
+	} else {
+		free(ptr)
+	}
+
+	if runtime.GOOS != "windows" {
+		var getpid func() int
+		purego.RegisterLibFunc(&getpid, libc, "getpid")
+		if got := getpid(); got != os.Getpid() {
+			t.Errorf("getpid returned %d wanted %d", got, os.Getpid())
+		}
+		var getpid32 func() int32
+		var getpidU32 func() uint32
+		var getpidBool func() bool
+		purego.RegisterLibFunc(&getpid32, libc, "getpid")
+		purego.RegisterLibFunc(&getpidU32, libc, "getpid")
+		purego.RegisterLibFunc(&getpidBool, libc, "getpid")
+		if got := getpid32(); got != int32(os.Getpid()) {
+			t.Errorf("getpid returned %d wanted %d", got, os.Getpid())
+		}
+		if got := getpidU32(); got != uint32(os.Getpid()) {
+			t.Errorf("getpid returned %d wanted %d", got, os.Getpid())
+		}
+		if got, want := getpidBool(), byte(os.Getpid()) != 0; got != want {
+			t.Errorf("getpid returned %t wanted %t", got, want)
+		}
+	}
+}
+
+func TestRegisterFunc_cVariadic(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" ||
+		runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("the variadic arguments aren't passed like the fixed arguments on this platform")
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	// the float is in a float register that snprintf only reads if AL says that it may have an argument
+	var snprintf func(buf []byte, size purego.Size, format string, args ...any) int32
+	purego.RegisterLibFunc(&snprintf, libc, "snprintf")
+	buf := make([]byte, 64)
+	n := snprintf(buf, purego.Size(len(buf)), "%d %.2f %s", int32(-3), 2.5, "purego")
+	if got, want := string(buf[:n]), "-3 2.50 purego"; got != want {
+		t.Errorf("snprintf wrote %q wanted %q", got, want)
+	}
+}
+
+func TestRegisterFunc_noReturnAllocs(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var randIgnored func()
+	var randInt func() int32
+	purego.RegisterLibFunc(&randIgnored, libc, "rand")
+	purego.RegisterLibFunc(&randInt, libc, "rand")
+	var absIgnored func(int32)
+	var absInt func(int32) int32
+	purego.RegisterLibFunc(&absIgnored, libc, "abs")
+	purego.RegisterLibFunc(&absInt, libc, "abs")
+
+	// a function without results must not pay for converting the return value,
+	// unless neither allocates since both are called without reflect.MakeFunc
+	ignored := testing.AllocsPerRun(100, func() { randIgnored() })
+	if used := testing.AllocsPerRun(100, func() { randInt() }); ignored >= used && used != 0 {
+		t.Errorf("func() made %v allocations and func() int32 %v wanted fewer", ignored, used)
+	}
+	ignored = testing.AllocsPerRun(100, func() { absIgnored(-1) })
+	if used := testing.AllocsPerRun(100, func() { absInt(-1) }); ignored >= used {
+		t.Errorf("func(int32) made %v allocations and func(int32) int32 %v wanted fewer", ignored, used)
+	}
+}
+
+func TestRegisterFunc_unsupportedReturn(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	for name, fptr := range map[string]any{
+		"complex128": new(func(float64) complex128),
+		"complex64":  new(func(float64) complex64),
+		"map":        new(func(float64) map[int]int),
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("registering a function that returns a %s didn't panic", name)
+				}
+			}()
+			purego.RegisterLibFunc(fptr, libc, "cos")
+		}()
+	}
+}
+
+func TestRegisterFunc_Counted(t *testing.T) {
+	if runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" {
+		t.Skip("Platform doesn't support callbacks")
+		return
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+
+	data := []int{88, 56, 100, 2, 25}
+	sorted := []int{2, 25, 56, 88, 100}
+	compare := func(_ purego.CDecl, a, b *int) int {
+		return *a - *b
+	}
+	// qsort takes the data and the number of items as its first two arguments
+	var qsort func(data purego.Counted[int], size uintptr, compar func(_ purego.CDecl, a, b *int) int)
+	purego.RegisterLibFunc(&qsort, libc, "qsort")
+	qsort(data, unsafe.Sizeof(int(0)), compare)
+	for i := range data {
+		if data[i] != sorted[i] {
+			t.Errorf("got %d wanted %d at %d", data[i], sorted[i], i)
+		}
+	}
+}
+
+// registerMemcpy registers memcpy for copying n elements of type T.
+func registerMemcpy[T any](memcpy *func(dst, src *T, n uintptr) unsafe.Pointer, handle uintptr) {
+	sym, err := load.OpenSymbol(handle, "memcpy")
+	if err != nil {
+		panic(err)
+	}
+	purego.RegisterFuncFor(memcpy, sym)
+}
+
+func TestRegisterFunc_generic(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	{
+		src, dst := []int32{1, -2, 3}, make([]int32, 3)
+		var memcpy func(dst, src *int32, n uintptr) unsafe.Pointer
+		registerMemcpy(&memcpy, libc)
+		memcpy(&dst[0], &src[0], uintptr(len(src))*unsafe.Sizeof(src[0]))
+		if !reflect.DeepEqual(dst, src) {
+			t.Errorf("memcpy copied %v wanted %v", dst, src)
+		}
+	}
+	{
+		src, dst := []float64{1.5, -2.5}, make([]float64, 2)
+		var memcpy func(dst, src *float64, n uintptr) unsafe.Pointer
+		registerMemcpy(&memcpy, libc)
+		memcpy(&dst[0], &src[0], uintptr(len(src))*unsafe.Sizeof(src[0]))
+		if !reflect.DeepEqual(dst, src) {
+			t.Errorf("memcpy copied %v wanted %v", dst, src)
+		}
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var strlen func(s uintptr) uintptr
+	purego.RegisterLibFunc(&strlen, libc, "strlen")
+
+	var gotName string
+	var gotArgs []uintptr
+	var gotRet uintptr
+	purego.SetTracer(func(name string, args []uintptr, ret uintptr) {
+		gotName, gotArgs, gotRet = name, args, ret
+	})
+	defer purego.SetTracer(nil)
+
+	s := []byte("purego\x00")
+	ptr := uintptr(unsafe.Pointer(&s[0]))
+	strlen(ptr)
+	runtime.KeepAlive(s)
+	if gotName != "strlen" {
+		t.Errorf("tracer got name %q wanted %q", gotName, "strlen")
+	}
+	if len(gotArgs) == 0 || gotArgs[0] != ptr {
+		t.Errorf("tracer got args %#x wanted the first to be %#x", gotArgs, ptr)
+	}
+	if gotRet != 6 {
+		t.Errorf("tracer got ret %d wanted %d", gotRet, 6)
+	}
+}
+
+func TestRegisterFunc_structField(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	type stringFuncs struct {
+		Strlen func(s string) uintptr
+		strcmp func(a, b string) int32
+	}
+	var lib stringFuncs
+	purego.RegisterLibFunc(&lib.Strlen, libc, "strlen")
+	purego.RegisterLibFunc(&lib.strcmp, libc, "strcmp")
+	if got := lib.Strlen("purego"); got != 6 {
+		t.Errorf("Strlen returned %d wanted %d", got, 6)
+	}
+	if got := lib.strcmp("purego", "purego"); got != 0 {
+		t.Errorf("strcmp returned %d wanted %d", got, 0)
+	}
+	// a field reached through reflect works as well
+	var lib2 stringFuncs
+	purego.RegisterLibFunc(reflect.ValueOf(&lib2).Elem().FieldByName("Strlen").Addr().Interface(), libc, "strlen")
+	if got := lib2.Strlen("purego"); got != 6 {
+		t.Errorf("Strlen returned %d wanted %d", got, 6)
+	}
+}
+
+func TestRegisterLibFuncWeak(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var strlen func(s string) uintptr
+	if !purego.RegisterLibFuncWeak(&strlen, libc, "strlen") {
+		t.Fatalf("RegisterLibFuncWeak didn't find strlen")
+	}
+	if got := strlen("purego"); got != 6 {
+		t.Errorf("strlen returned %d wanted %d", got, 6)
+	}
+	missing := func() {}
+	if purego.RegisterLibFuncWeak(&missing, libc, "purego_symbol_that_does_not_exist") {
+		t.Fatalf("RegisterLibFuncWeak found a symbol that doesn't exist")
+	}
+	if missing != nil {
+		t.Errorf("RegisterLibFuncWeak didn't set the function to nil")
+	}
+}
+
+func TestRegisterLibFunc_RTLD_DEFAULT(t *testing.T) {
+	name := "getpid"
+	if runtime.GOOS == "windows" {
+		name = "GetCurrentProcessId"
+	}
+	var getpid func() int32
+	purego.RegisterLibFunc(&getpid, purego.RTLD_DEFAULT, name)
+	if got, want := getpid(), int32(os.Getpid()); got != want {
+		t.Errorf("%s returned %d wanted %d", name, got, want)
+	}
+}
+
+func TestRegisterFunc_arrayPointer(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	// void *memset(void *s, int c, size_t n);
+	var memsetSlice func(s []int32, c int32, n purego.Size) *int32
+	purego.RegisterLibFunc(&memsetSlice, libc, "memset")
+	var memsetArray func(s *[16]int32, c int32, n purego.Size) *int32
+	purego.RegisterLibFunc(&memsetArray, libc, "memset")
+
+	const n = 16 * 4
+	out := new([16]int32)
+	if p := memsetArray(out, 0x01, n); p != &out[0] {
+		t.Errorf("memset with *[16]int32 returned %p wanted %p", p, &out[0])
+	}
+	for i, v := range out {
+		if v != 0x01010101 {
+			t.Fatalf("out[%d] = %#x wanted %#x", i, v, 0x01010101)
+		}
+	}
+	if p := memsetSlice(out[:], 0x02, n); p != &out[0] {
+		t.Errorf("memset with []int32 returned %p wanted %p", p, &out[0])
+	}
+	for i, v := range out {
+		if v != 0x02020202 {
+			t.Fatalf("out[%d] = %#x wanted %#x", i, v, 0x02020202)
+		}
+	}
+}
+
+func TestRegisterFunc_interface(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	// void *memset(void *s, int c, size_t n);
+	var memset func(s any, c int32, n purego.Size) unsafe.Pointer
+	purego.RegisterLibFunc(&memset, libc, "memset")
+
+	array := new([4]int32)
+	slice := make([]byte, 8)
+	if p := memset(array, 0x01, 16); p != unsafe.Pointer(array) {
+		t.Errorf("memset with *[4]int32 returned %p wanted %p", p, array)
+	}
+	if array[3] != 0x01010101 {
+		t.Errorf("memset with *[4]int32 set %#x wanted %#x", array[3], 0x01010101)
+	}
+	if p := memset(slice, 0x02, 8); p != unsafe.Pointer(&slice[0]) {
+		t.Errorf("memset with []byte returned %p wanted %p", p, &slice[0])
+	}
+	if slice[7] != 0x02 {
+		t.Errorf("memset with []byte set %#x wanted %#x", slice[7], 0x02)
+	}
+	if p := memset(nil, 0, 0); p != nil {
+		t.Errorf("memset with nil returned %p wanted nil", p)
+	}
+}
+
+func TestToUintptr(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	strlen, err := load.OpenSymbol(libc, "strlen")
+	if err != nil {
+		t.Fatalf("failed to find strlen: %s", err)
+	}
+	s, isFloat, keepAlive := purego.ToUintptr("purego")
+	if isFloat {
+		t.Errorf("ToUintptr of a string returned a float")
+	}
+	n, _, _ := purego.SyscallN(strlen, s)
+	runtime.KeepAlive(keepAlive)
+	if n != 6 {
+		t.Errorf("strlen returned %d wanted %d", n, 6)
+	}
+
+	x := 7
+	for _, test := range []struct {
+		v       any
+		val     uintptr
+		isFloat bool
+	}{
+		{nil, 0, false},
+		{true, 1, false},
+		{int8(-1), ^uintptr(0), false},
+		{uint16(0xbeef), 0xbeef, false},
+		{&x, uintptr(unsafe.Pointer(&x)), false},
+		{1.5, uintptr(math.Float64bits(1.5)), true},
+		{float32(1.5), uintptr(math.Float32bits(1.5)), true},
+	} {
+		val, isFloat, _ := purego.ToUintptr(test.v)
+		if val != test.val || isFloat != test.isFloat {
+			t.Errorf("ToUintptr(%v) returned %#x, %t wanted %#x, %t", test.v, val, isFloat, test.val, test.isFloat)
+		}
+	}
+}
+
+func TestRegisterFunc_Size(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var strnlen func(s string, maxlen purego.Size) purego.Size
+	purego.RegisterLibFunc(&strnlen, libc, "strnlen")
+	if got := strnlen("purego\x00", 100); got != 6 {
+		t.Errorf("strnlen returned %d wanted %d", got, 6)
+	}
+	if got := strnlen("purego\x00", 4); got != 4 {
+		t.Errorf("strnlen returned %d wanted %d", got, 4)
+	}
+}
+
+func TestRegisterFuncType(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	sym, err := load.OpenSymbol(libc, "strnlen")
+	if err != nil {
+		t.Fatalf("failed to find strnlen: %s", err)
+	}
+	sizeType := reflect.TypeOf(purego.Size(0))
+	ty := reflect.FuncOf([]reflect.Type{reflect.TypeOf(""), sizeType}, []reflect.Type{sizeType}, false)
+	strnlen := purego.RegisterFuncType(ty, sym)
+	if strnlen.Type() != ty {
+		t.Fatalf("RegisterFuncType returned a %v wanted a %v", strnlen.Type(), ty)
+	}
+	results := strnlen.Call([]reflect.Value{reflect.ValueOf("purego\x00"), reflect.ValueOf(purego.Size(4))})
+	if got := results[0].Interface().(purego.Size); got != 4 {
+		t.Errorf("strnlen returned %d wanted %d", got, 4)
+	}
+	// the value can also be stored in a variable of the same type
+	var strnlenFn func(string, purego.Size) purego.Size
+	reflect.ValueOf(&strnlenFn).Elem().Set(strnlen)
+	if got := strnlenFn("purego\x00", 100); got != 6 {
+		t.Errorf("strnlen returned %d wanted %d", got, 6)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("RegisterFuncType with a non-function type didn't panic")
+		}
+	}()
+	purego.RegisterFuncType(sizeType, sym)
+}
+
+func TestRegisterFunc_WString(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var wcslen func(s purego.WString) purego.Size
+	purego.RegisterLibFunc(&wcslen, libc, "wcslen")
+	var wcschr func(s purego.WString, c purego.WChar) purego.WString
+	purego.RegisterLibFunc(&wcschr, libc, "wcschr")
+	const s = "héllo, 世界"
+	if got, want := wcslen(s), purego.Size(len([]rune(s))); got != want {
+		t.Errorf("wcslen returned %d wanted %d", got, want)
+	}
+	if got, want := wcschr(s, '世'), purego.WString("世界"); got != want {
+		t.Errorf("wcschr returned %q wanted %q", got, want)
+	}
+	if got := purego.GoWString(purego.WCharPtr(s)); got != s {
+		t.Errorf("GoWString returned %q wanted %q", got, s)
+	}
+}
+
+func TestRegisterFunc_blockingCall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Platform doesn't have usleep")
+		return
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var usleep func(usec uint32) int32
+	purego.RegisterLibFunc(&usleep, libc, "usleep")
+
+	// with a single P this goroutine can only run while usleep blocks if the call released the P
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		close(started)
+		usleep(500_000)
+		close(done)
+	}()
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Errorf("other goroutines didn't run while usleep was blocking")
+	default:
+	}
+	<-done
+}
+
+func TestRegisterFunc_threadLocalString(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Platform doesn't use thread-local buffers for strerror")
+		return
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var strerror func(errnum int32) string
+	purego.RegisterLibFunc(&strerror, libc, "strerror")
+
+	// the messages of unknown error numbers are formatted into a thread-local buffer
+	const goroutines = 8
+	var expected [goroutines]string
+	for i := range expected {
+		expected[i] = strerror(int32(10000 + i))
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if got := strerror(int32(10000 + i)); got != expected[i] {
+					errs <- fmt.Errorf("strerror returned %q wanted %q", got, expected[i])
+					return
+				}
+				runtime.Gosched()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestVaList(t *testing.T) {
+	if runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" || runtime.GOOS == "windows" {
+		t.Skip("Platform doesn't support va_list or vsnprintf")
+		return
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var vsnprintf func(str []byte, size purego.Size, format string, ap unsafe.Pointer) int32
+	purego.RegisterLibFunc(&vsnprintf, libc, "vsnprintf")
+
+	buf := make([]byte, 128)
+	ap, release := purego.VaList(int32(-42), "purego", 1.25, uint64(0xdeadbeefcafe), 'x', "", float32(0.5), 1, 2, 3)
+	defer release()
+	n := vsnprintf(buf, purego.Size(len(buf)), "%d %s %.2f %llx %c %s %.1f %d %d %d\x00", ap)
+	const expected = "-42 purego 1.25 deadbeefcafe x  0.5 1 2 3"
+	if got := string(buf[:n]); got != expected {
+		t.Errorf("vsnprintf formatted %q wanted %q", got, expected)
+	}
+	empty, releaseEmpty := purego.VaList()
+	defer releaseEmpty()
+	if n := vsnprintf(buf, purego.Size(len(buf)), "no arguments\x00", empty); string(buf[:n]) != "no arguments" {
+		t.Errorf("vsnprintf formatted %q wanted %q", buf[:n], "no arguments")
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	if runtime.GOARCH != "arm64" && runtime.GOARCH != "amd64" || runtime.GOOS == "windows" {
+		t.Skip("Platform doesn't support callbacks with float arguments")
+		return
+	}
+	// fixed16 is a 16.16 fixed-point number which C receives as its integer part and its value as a double
+	type fixed16 struct {
+		raw int32
+	}
+	purego.RegisterConverter(reflect.TypeOf(fixed16{}), func(v reflect.Value) (ints []uintptr, floats []uintptr) {
+		f := v.Interface().(fixed16)
+		return []uintptr{uintptr(f.raw >> 16)}, []uintptr{uintptr(math.Float64bits(float64(f.raw) / (1 << 16)))}
+	})
+	var gotInt int
+	var gotFloat float64
+	cb := purego.NewCallback(func(a int, b float64, c int) int {
+		gotInt = a
+		gotFloat = b
+		return c
+	})
+	var fn func(f fixed16, c int) int
+	purego.RegisterFunc(&fn, cb)
+	if ret := fn(fixed16{raw: 3<<16 | 1<<15}, 7); ret != 7 {
+		t.Errorf("fn returned %d wanted %d", ret, 7)
+	}
+	if gotInt != 3 {
+		t.Errorf("integer part was %d wanted %d", gotInt, 3)
+	}
+	if gotFloat != 3.5 {
+		t.Errorf("float value was %f wanted %f", gotFloat, 3.5)
+	}
+}
+
+func TestRegisterFunc_errno(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("errno isn't returned on Windows")
+	}
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+
+	var closeFd func(fd int32) (int32, error)
+	purego.RegisterLibFunc(&closeFd, libc, "close")
+	if ret, err := closeFd(-1); ret != -1 || err != syscall.EBADF {
+		t.Errorf("close(-1) returned %d, %v wanted %d, %v", ret, err, -1, syscall.EBADF)
+	}
+
+	var fopen func(path, mode string) (unsafe.Pointer, error)
+	purego.RegisterLibFunc(&fopen, libc, "fopen")
+	if f, err := fopen("/purego/file/that/does/not/exist", "r"); f != nil || err != syscall.ENOENT {
+		t.Errorf("fopen returned %v, %v wanted %v, %v", f, err, nil, syscall.ENOENT)
+	}
+
+	type file struct{}
+	var fopenFile func(path, mode string) (*file, error)
+	purego.RegisterLibFunc(&fopenFile, libc, "fopen")
+	if f, err := fopenFile("/purego/file/that/does/not/exist", "r"); f != nil || err != syscall.ENOENT {
+		t.Errorf("fopen returned %v, %v wanted %v, %v", f, err, nil, syscall.ENOENT)
+	}
+
+	var dup func(fd int32) (int32, error)
+	purego.RegisterLibFunc(&dup, libc, "dup")
+	fd, err := dup(int32(os.Stdout.Fd()))
+	if fd < 0 || err != nil {
+		t.Fatalf("dup returned %d, %v wanted a file descriptor and no error", fd, err)
+	}
+	var closeErrno func(fd int32) (int32, syscall.Errno)
+	purego.RegisterLibFunc(&closeErrno, libc, "close")
+	if ret, _ := closeErrno(fd); ret != 0 {
+		t.Errorf("close(%d) returned %d wanted %d", fd, ret, 0)
+	}
+	if ret, errno := closeErrno(fd); ret != -1 || errno != syscall.EBADF {
+		t.Errorf("closing %d again returned %d, %v wanted %d, %v", fd, ret, errno, -1, syscall.EBADF)
+	}
+}
+
+func TestRegisterFunc_TimeT(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	name := "time"
+	if runtime.GOOS == "windows" {
+		// time is an inline function that calls _time64 in the headers of the UCRT
+		name = "_time64"
+	}
+	var timeFn func(tloc *purego.TimeT) purego.TimeT
+	purego.RegisterLibFunc(&timeFn, libc, name)
+	var tloc purego.TimeT
+	before := time.Now().Unix()
+	now := timeFn(&tloc)
+	after := time.Now().Unix()
+	// time may read a coarser clock than time.Now so allow it to be a second behind
+	if int64(now) < before-1 || int64(now) > after || tloc != now {
+		t.Errorf("%s returned %d and stored %d wanted a value between %d and %d", name, now, tloc, before-1, after)
+	}
+}
+
+func TestRegisterFunc_CPtr(t *testing.T) {
+	library, err := getSystemLibrary()
+	if err != nil {
+		t.Fatalf("couldn't get system library: %s", err)
+	}
+	libc, err := load.OpenLibrary(library)
+	if err != nil {
+		t.Fatalf("failed to dlopen: %s", err)
+	}
+	var malloc func(size purego.Size) purego.CPtr
+	purego.RegisterLibFunc(&malloc, libc, "malloc")
+	var memset func(ptr purego.CPtr, c int32, n purego.Size) purego.CPtr
+	purego.RegisterLibFunc(&memset, libc, "memset")
+	var free func(ptr purego.CPtr)
+	purego.RegisterLibFunc(&free, libc, "free")
+
+	ptr := malloc(16)
+	if ptr == 0 {
+		t.Fatal("malloc returned NULL")
+	}
+	defer free(ptr)
+	if got := memset(ptr, 0x5a, 16); got != ptr {
+		t.Errorf("memset returned %#x wanted %#x", got, ptr)
+	}
+	for i, b := range unsafe.Slice((*byte)(ptr.Pointer()), 16) {
+		if b != 0x5a {
+			t.Errorf("byte %d is %#x wanted %#x", i, b, 0x5a)
+		}
+	}
+}
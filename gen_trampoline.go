@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build ignore
+
+// gen_trampoline.go writes the syscall15X trampoline of an architecture that passes arguments in registers
+// like arm64 does. It is the starting point to port purego to another architecture since the trampoline is
+// the only assembly that a call needs:
+//
+//	go run gen_trampoline.go -arch riscv64 > sys_riscv64.s
+//
+// To add an architecture, describe its C calling convention in archs. The trampoline isn't all that a port needs:
+// it also needs a build of fakecgo (or Cgo), callbackasm for NewCallback and the placement of struct arguments.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// arch describes how the trampoline calls a C function on an architecture.
+type arch struct {
+	// Ints and Floats are the registers that the integer and floating-point arguments are passed in.
+	// The first of Ints has the pointer to syscall15Args when the trampoline is called.
+	Ints, Floats []string
+	// IntRets and FloatRets are the registers of the return values that are stored.
+	IntRets, FloatRets []string
+	// Tmp and Fn are free registers for the pointer to syscall15Args and the function being called.
+	// Zero is a register that is always zero.
+	Tmp, Fn, Zero string
+	// Mov, MovFloat and MovInt32 load and store 8-byte integers and float64s and sign extend a loaded int32.
+	Mov, MovFloat, MovInt32 string
+	// SP is the name of the stack pointer and Grow and Shrink allocate and free the stack with the size STACK_SIZE.
+	SP, Grow, Shrink string
+	// Pushed is the number of bytes that the prologue which the assembler adds puts on the stack.
+	// The stack must be aligned to 16 bytes at the call which it is when the trampoline is called.
+	Pushed int
+	// Call calls the function in Fn and CallTmp calls the function in Tmp.
+	// IfZero branches to the label noerrno if the register Tmp is zero.
+	Call, CallTmp, IfZero string
+}
+
+var archs = map[string]arch{
+	// https://github.com/riscv-non-isa/riscv-elf-psabi-doc/blob/master/riscv-cc.adoc
+	"riscv64": {
+		Ints:      []string{"X10", "X11", "X12", "X13", "X14", "X15", "X16", "X17"},
+		Floats:    []string{"F10", "F11", "F12", "F13", "F14", "F15", "F16", "F17"},
+		IntRets:   []string{"X10", "X11"},
+		FloatRets: []string{"F10", "F11"},
+		Tmp:       "X5",
+		Fn:        "X6",
+		Zero:      "ZERO",
+		Mov:       "MOV",
+		MovFloat:  "MOVD",
+		MovInt32:  "MOVW",
+		SP:        "SP",
+		Grow:      "ADD $-STACK_SIZE, SP",
+		Shrink:    "ADD $STACK_SIZE, SP",
+		Pushed:    8, // the return address
+		Call:      "JALR RA, (X6)",
+		CallTmp:   "JALR RA, (X5)",
+		IfZero:    "BEQZ X5, noerrno",
+	},
+	// https://github.com/loongson/la-abi-specs/blob/release/lapcs.adoc
+	"loong64": {
+		Ints:      []string{"R4", "R5", "R6", "R7", "R8", "R9", "R10", "R11"},
+		Floats:    []string{"F0", "F1", "F2", "F3", "F4", "F5", "F6", "F7"},
+		IntRets:   []string{"R4", "R5"},
+		FloatRets: []string{"F0", "F1"},
+		Tmp:       "R12",
+		Fn:        "R13",
+		Zero:      "R0",
+		Mov:       "MOVV",
+		MovFloat:  "MOVD",
+		MovInt32:  "MOVW",
+		SP:        "R3",
+		Grow:      "SUBV $STACK_SIZE, R3",
+		Shrink:    "ADDV $STACK_SIZE, R3",
+		Pushed:    8, // the return address
+		Call:      "JAL (R13)",
+		CallTmp:   "JAL (R12)",
+		IfZero:    "BEQ R12, noerrno",
+	},
+}
+
+const numArgs = 15
+
+const templateTrampoline = `// Code generated by 'go run gen_trampoline.go -arch {{.Name}}'. DO NOT EDIT.
+
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build linux
+
+#include "textflag.h"
+#include "go_asm.h"
+#include "funcdata.h"
+
+// the stack arguments followed by the pointer to syscall15Args, padded to keep the stack aligned to 16 bytes
+#define STACK_SIZE {{.StackSize}}
+#define PTR_ADDRESS (STACK_SIZE - 8)
+
+// syscall15X calls the C function fn of the syscall15Args that it takes a pointer to with its arguments
+// and stores the return values in a1, a2, f1 and f2. If errno isn't zero, it is called right after with
+// the same thread to get the address of errno and the value is stored in errno.
+// syscall15X must be called on the g0 stack with the C calling convention.
+GLOBL ·syscall15XABI0(SB), NOPTR|RODATA, $8
+DATA ·syscall15XABI0(SB)/8, $syscall15X(SB)
+TEXT syscall15X(SB), NOSPLIT, $0
+	{{.Grow}}
+	{{.Mov}} {{index .Ints 0}}, PTR_ADDRESS({{.SP}}) // save the pointer
+	{{.Mov}} {{index .Ints 0}}, {{.Tmp}}
+{{range $i, $r := .Floats}}
+	{{$.MovFloat}} syscall15Args_f{{inc $i}}({{$.Tmp}}), {{$r}}
+{{- end}}
+{{range $i, $r := .Ints}}
+	{{$.Mov}} syscall15Args_a{{inc $i}}({{$.Tmp}}), {{$r}}
+{{- end}}
+{{range .Stack}}
+	{{$.Mov}} syscall15Args_a{{.Arg}}({{$.Tmp}}), {{$.Fn}}
+	{{$.Mov}} {{$.Fn}}, {{.Offset}}({{$.SP}}) // push a{{.Arg}} onto the stack
+{{- end}}
+
+	{{.Mov}} syscall15Args_fn({{.Tmp}}), {{.Fn}}
+	{{.Call}}
+
+	{{.Mov}} PTR_ADDRESS({{.SP}}), {{.Tmp}} // get the pointer back
+{{- range $i, $r := .IntRets}}
+	{{$.Mov}} {{$r}}, syscall15Args_a{{inc $i}}({{$.Tmp}})
+{{- end}}
+{{- range $i, $r := .FloatRets}}
+	{{$.MovFloat}} {{$r}}, syscall15Args_f{{inc $i}}({{$.Tmp}})
+{{- end}}
+	{{.Mov}} {{.Zero}}, syscall15Args_flags({{.Tmp}}) // there are no flags to save
+
+	// read errno on this thread before anything else can change it
+	{{.Mov}} syscall15Args_errno({{.Tmp}}), {{.Tmp}}
+	{{.IfZero}}
+	{{.CallTmp}} // returns &errno
+	{{.MovInt32}} ({{index .IntRets 0}}), {{index .IntRets 0}}
+	{{.Mov}} PTR_ADDRESS({{.SP}}), {{.Tmp}}
+	{{.Mov}} {{index .IntRets 0}}, syscall15Args_errno({{.Tmp}})
+
+noerrno:
+	{{.Shrink}}
+	RET
+`
+
+type stackArg struct {
+	Arg    int
+	Offset int
+}
+
+func main() {
+	name := flag.String("arch", "", "the GOARCH to write the trampoline of")
+	flag.Parse()
+	a, ok := archs[*name]
+	if !ok {
+		var names []string
+		for n := range archs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		log.Fatalf("unknown -arch %q, it must be one of %s", *name, strings.Join(names, ", "))
+	}
+	var stack []stackArg
+	for i := len(a.Ints) + 1; i <= numArgs; i++ {
+		stack = append(stack, stackArg{Arg: i, Offset: len(stack) * 8})
+	}
+	t := template.Must(template.New("trampoline").Funcs(template.FuncMap{
+		"inc": func(i int) int { return i + 1 },
+	}).Parse(templateTrampoline))
+	size := (len(stack)*8+8+a.Pushed+15)&^15 - a.Pushed
+	if err := t.Execute(os.Stdout, struct {
+		arch
+		Name      string
+		Stack     []stackArg
+		StackSize int
+	}{a, *name, stack, size}); err != nil {
+		log.Fatal(err)
+	}
+}
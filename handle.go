@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Handle is a value that is passed to C in place of a Go value that C must not have a pointer to.
+// It works like [runtime/cgo.Handle] which can't be used without Cgo.
+//
+// A C API that takes a callback often also takes a void* that it passes back to the callback untouched.
+// A pointer to Go memory can't be that void* since C keeps it after the call returns, when nothing keeps the memory
+// alive for the garbage collector. A Handle is an integer that C can keep for as long as it likes instead.
+// It is passed as the void* to the function registered with RegisterFunc and the callback can declare
+// the void* as a Handle to get the value back:
+//
+//	// void for_each(const int *values, int n, void (*fn)(void *ctx, int value), void *ctx);
+//	var forEach func(values []int32, n int, fn uintptr, ctx purego.Handle)
+//	cb := purego.NewCallback(func(ctx purego.Handle, value int32) {
+//		ctx.Value().(*Sum).Add(value)
+//	})
+//	h := purego.NewHandle(&sum)
+//	defer h.Delete()
+//	forEach(values, len(values), cb, h)
+//
+// The value is kept alive until Delete is called, which must be done when C doesn't use the Handle anymore.
+type Handle uintptr
+
+var (
+	handles   sync.Map // map[Handle]any
+	handleIdx uintptr  // the last Handle that was returned by NewHandle
+)
+
+// NewHandle returns a Handle for v. Each call returns a new Handle even for the same v.
+// It panics if it runs out of handles, which can only happen if they aren't deleted.
+func NewHandle(v any) Handle {
+	h := Handle(atomic.AddUintptr(&handleIdx, 1))
+	if h == 0 {
+		panic("purego: ran out of handle space")
+	}
+	handles.Store(h, v)
+	return h
+}
+
+// Value returns the value of h. It panics if h isn't valid.
+func (h Handle) Value() any {
+	v, ok := handles.Load(h)
+	if !ok {
+		panic("purego: misuse of an invalid Handle")
+	}
+	return v
+}
+
+// Delete invalidates h so that the value can be garbage collected. It panics if h is already invalid.
+func (h Handle) Delete() {
+	if _, ok := handles.LoadAndDelete(h); !ok {
+		panic("purego: misuse of an invalid Handle")
+	}
+}
@@ -15,12 +15,20 @@ import "C"
 
 import (
 	"errors"
+	"runtime"
 	"unsafe"
 )
 
 func Dlopen(filename string, flag int) (uintptr, error) {
-	cfilename := C.CString(filename)
-	defer C.free(unsafe.Pointer(cfilename))
+	// an empty filename is NULL for the handle of the main program
+	var cfilename *C.char
+	if filename != "" {
+		cfilename = C.CString(filename)
+		defer C.free(unsafe.Pointer(cfilename))
+	}
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	handle := C.dlopen(cfilename, C.int(flag))
 	if handle == nil {
 		return 0, errors.New(C.GoString(C.dlerror()))
@@ -31,6 +39,9 @@ func Dlopen(filename string, flag int) (uintptr, error) {
 func Dlsym(handle uintptr, symbol string) (uintptr, error) {
 	csymbol := C.CString(symbol)
 	defer C.free(unsafe.Pointer(csymbol))
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	symbolAddr := C.dlsym(*(*unsafe.Pointer)(unsafe.Pointer(&handle)), csymbol)
 	if symbolAddr == nil {
 		return 0, errors.New(C.GoString(C.dlerror()))
@@ -39,6 +50,9 @@ func Dlsym(handle uintptr, symbol string) (uintptr, error) {
 }
 
 func Dlclose(handle uintptr) error {
+	// dlerror is per thread so it must be called on the thread that failed
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	result := C.dlclose(*(*unsafe.Pointer)(unsafe.Pointer(&handle)))
 	if result != 0 {
 		return errors.New(C.GoString(C.dlerror()))
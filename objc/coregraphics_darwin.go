@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package objc
+
+// CGFloat is the type that Core Graphics uses for floating-point values.
+// It is a double on every platform that Go supports for macOS and iOS since they are all 64-bit.
+type CGFloat = float64
+
+// CGPoint is a point in a two-dimensional coordinate system.
+type CGPoint struct {
+	X, Y CGFloat
+}
+
+// CGSize is the width and height of a rectangle.
+type CGSize struct {
+	Width, Height CGFloat
+}
+
+// CGRect is the location and size of a rectangle.
+//
+// The struct types in this file have the same layout as their C counterparts, so they can be used
+// as the arguments and return values of messages, and of functions registered with purego.RegisterFunc:
+//
+//	var NSValue struct {
+//		ValueWithRect func(class objc.ID, rect objc.CGRect) objc.ID `objc:"valueWithRect:"`
+//		RectValue     func(self objc.ID) objc.CGRect                `objc:"rectValue"`
+//	}
+type CGRect struct {
+	Origin CGPoint
+	Size   CGSize
+}
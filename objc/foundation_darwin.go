@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package objc
+
+import "sync"
+
+var (
+	nsArrayOnce sync.Once
+	nsArray     struct {
+		Count         func(self ID) uint           `objc:"count"`
+		ObjectAtIndex func(self ID, index uint) ID `objc:"objectAtIndex:"`
+	}
+)
+
+// NSArrayToSlice returns the objects of the NSArray arr in the same order. It sends count and objectAtIndex:
+// to arr, so it works for any object that implements them like NSMutableArray. A nil arr returns nil.
+//
+// The objects aren't retained. They are only valid as long as arr holds them, so an object that must outlive
+// the array has to be retained by the caller. Foundation must be loaded to create NSArrays.
+func NSArrayToSlice(arr ID) []ID {
+	if arr == 0 {
+		return nil
+	}
+	nsArrayOnce.Do(func() {
+		BindMethods(&nsArray)
+	})
+	n := nsArray.Count(arr)
+	objects := make([]ID, n)
+	for i := range objects {
+		objects[i] = nsArray.ObjectAtIndex(arr, uint(i))
+	}
+	return objects
+}
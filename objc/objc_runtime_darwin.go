@@ -3,6 +3,17 @@
 
 // Package objc is a low-level pure Go objective-c runtime. This package is easy to use incorrectly, so it is best
 // to use a wrapper that provides the functionality you need in a safer way.
+//
+// # Concurrency
+//
+// The functions in this package are safe to call from multiple goroutines at the same time. Sending a message
+// only reads the runtime functions that are loaded when the package is initialized, and any memory the call needs
+// (like the objc_super of SendSuper) is allocated for that call alone. The Objective-C runtime functions themselves,
+// like sel_registerName and objc_getClass, take the runtime's own locks.
+//
+// This doesn't make the objects that messages are sent to thread-safe. Many classes, including most of AppKit and UIKit,
+// must only be used from the main thread. Call runtime.LockOSThread in an init function of the main package to keep
+// the main goroutine on the main thread.
 package objc
 
 import (
@@ -12,6 +23,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sync"
 	"unicode"
 	"unsafe"
 
@@ -21,30 +33,37 @@ import (
 // TODO: support try/catch?
 // https://stackoverflow.com/questions/7062599/example-of-how-objective-cs-try-catch-implementation-is-executed-at-runtime
 var (
-	objc_msgSend_fn             uintptr
-	objc_msgSend_stret_fn       uintptr
-	objc_msgSend                func(obj ID, cmd SEL, args ...any) ID
-	objc_msgSendSuper2_fn       uintptr
-	objc_msgSendSuper2_stret_fn uintptr
-	objc_msgSendSuper2          func(super *objc_super, cmd SEL, args ...any) ID
-	objc_getClass               func(name string) Class
-	objc_getProtocol            func(name string) *Protocol
-	objc_allocateClassPair      func(super Class, name string, extraBytes uintptr) Class
-	objc_registerClassPair      func(class Class)
-	sel_registerName            func(name string) SEL
-	class_getSuperclass         func(class Class) Class
-	class_getInstanceVariable   func(class Class, name string) Ivar
-	class_getInstanceSize       func(class Class) uintptr
-	class_addMethod             func(class Class, name SEL, imp IMP, types string) bool
-	class_addIvar               func(class Class, name string, size uintptr, alignment uint8, types string) bool
-	class_addProtocol           func(class Class, protocol *Protocol) bool
-	ivar_getOffset              func(ivar Ivar) uintptr
-	ivar_getName                func(ivar Ivar) string
-	object_getClass             func(obj ID) Class
-	object_getIvar              func(obj ID, ivar Ivar) ID
-	object_setIvar              func(obj ID, ivar Ivar, value ID)
-	protocol_getName            func(protocol *Protocol) string
-	protocol_isEqual            func(p *Protocol, p2 *Protocol) bool
+	objc_msgSend_fn               uintptr
+	objc_msgSend_stret_fn         uintptr
+	objc_msgSend                  func(obj ID, cmd SEL, args ...any) ID
+	objc_msgSendSuper2_fn         uintptr
+	objc_msgSendSuper2_stret_fn   uintptr
+	objc_msgSendSuper2            func(super *objc_super, cmd SEL, args ...any) ID
+	objc_getClass                 func(name string) Class
+	objc_getProtocol              func(name string) *Protocol
+	objc_allocateClassPair        func(super Class, name string, extraBytes uintptr) Class
+	objc_registerClassPair        func(class Class)
+	sel_registerName              func(name string) SEL
+	class_getSuperclass           func(class Class) Class
+	class_getInstanceVariable     func(class Class, name string) Ivar
+	class_getInstanceSize         func(class Class) uintptr
+	class_addMethod               func(class Class, name SEL, imp IMP, types string) bool
+	class_getMethodImplementation func(class Class, name SEL) IMP
+	class_addIvar                 func(class Class, name string, size uintptr, alignment uint8, types string) bool
+	class_addProtocol             func(class Class, protocol *Protocol) bool
+	ivar_getOffset                func(ivar Ivar) uintptr
+	ivar_getName                  func(ivar Ivar) string
+	object_getClass               func(obj ID) Class
+	object_getIvar                func(obj ID, ivar Ivar) ID
+	object_setIvar                func(obj ID, ivar Ivar, value ID)
+	protocol_getName              func(protocol *Protocol) string
+	protocol_isEqual              func(p *Protocol, p2 *Protocol) bool
+)
+
+var (
+	objc_setAssociatedObject     func(obj ID, key unsafe.Pointer, value ID, policy AssociationPolicy)
+	objc_getAssociatedObject     func(obj ID, key unsafe.Pointer) ID
+	objc_removeAssociatedObjects func(obj ID)
 )
 
 func init() {
@@ -81,6 +100,7 @@ func init() {
 	purego.RegisterLibFunc(&class_getSuperclass, objc, "class_getSuperclass")
 	purego.RegisterLibFunc(&class_getInstanceVariable, objc, "class_getInstanceVariable")
 	purego.RegisterLibFunc(&class_addMethod, objc, "class_addMethod")
+	purego.RegisterLibFunc(&class_getMethodImplementation, objc, "class_getMethodImplementation")
 	purego.RegisterLibFunc(&class_addIvar, objc, "class_addIvar")
 	purego.RegisterLibFunc(&class_addProtocol, objc, "class_addProtocol")
 	purego.RegisterLibFunc(&class_getInstanceSize, objc, "class_getInstanceSize")
@@ -90,6 +110,9 @@ func init() {
 	purego.RegisterLibFunc(&protocol_isEqual, objc, "protocol_isEqual")
 	purego.RegisterLibFunc(&object_getIvar, objc, "object_getIvar")
 	purego.RegisterLibFunc(&object_setIvar, objc, "object_setIvar")
+	purego.RegisterLibFunc(&objc_setAssociatedObject, objc, "objc_setAssociatedObject")
+	purego.RegisterLibFunc(&objc_getAssociatedObject, objc, "objc_getAssociatedObject")
+	purego.RegisterLibFunc(&objc_removeAssociatedObjects, objc, "objc_removeAssociatedObjects")
 }
 
 // ID is an opaque pointer to some Objective-C object
@@ -107,6 +130,44 @@ func (id ID) Send(sel SEL, args ...any) ID {
 	return objc_msgSend(id, sel, args...)
 }
 
+// SendFormat sends a message whose method is variadic after its format argument, like stringWithFormat:
+// of NSString, with args as the variadic arguments:
+//
+//	str := objc.ID(objc.GetClass("NSString")).SendFormat(objc.RegisterName("stringWithFormat:"), format, int32(1), 2.5, name)
+//
+// The arguments are promoted like the arguments of a C variadic function: float32 is passed as a double,
+// and integers, bools, pointers and IDs are passed as integers. A string is passed as a null-terminated C string
+// for %s. On arm64 every variadic argument is passed on the stack so up to 7 arguments can be used.
+func (id ID) SendFormat(sel SEL, format ID, args ...any) ID {
+	var varargs []any
+	if runtime.GOARCH == "arm64" {
+		// Apple's arm64 calling convention passes the variadic arguments on the stack, which purego places
+		// the arguments that don't fit in the 8 integer registers on. Fill the registers after self, _cmd and the format
+		// and pass every argument as an 8-byte integer so that it takes one slot of the stack.
+		varargs = make([]any, 5, 5+len(args))
+		for i := range varargs {
+			varargs[i] = uintptr(0)
+		}
+	}
+	for _, arg := range args {
+		switch v := reflect.ValueOf(arg); v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if runtime.GOARCH == "arm64" {
+				arg = uintptr(math.Float64bits(v.Float()))
+			} else {
+				arg = v.Float()
+			}
+		case reflect.Bool, reflect.String, reflect.Pointer, reflect.UnsafePointer,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			panic("objc: unsupported variadic argument of kind " + v.Kind().String())
+		}
+		varargs = append(varargs, arg)
+	}
+	return objc_msgSend(id, sel, append([]any{format}, varargs...)...)
+}
+
 // GetIvar reads the value of an instance variable in an object.
 func (id ID) GetIvar(ivar Ivar) ID {
 	return object_getIvar(id, ivar)
@@ -117,6 +178,38 @@ func (id ID) SetIvar(ivar Ivar, value ID) {
 	object_setIvar(id, ivar, value)
 }
 
+// AssociationPolicy is the memory management policy of an associated object.
+// See [Apple Docs] for the meaning of each policy.
+//
+// [Apple Docs]: https://developer.apple.com/documentation/objectivec/objc_associationpolicy
+type AssociationPolicy uintptr
+
+const (
+	AssociationAssign          AssociationPolicy = 0     // OBJC_ASSOCIATION_ASSIGN
+	AssociationRetainNonatomic AssociationPolicy = 1     // OBJC_ASSOCIATION_RETAIN_NONATOMIC
+	AssociationCopyNonatomic   AssociationPolicy = 3     // OBJC_ASSOCIATION_COPY_NONATOMIC
+	AssociationRetain          AssociationPolicy = 01401 // OBJC_ASSOCIATION_RETAIN
+	AssociationCopy            AssociationPolicy = 01403 // OBJC_ASSOCIATION_COPY
+)
+
+// SetAssociatedObject associates value with the object for key using the given policy. Setting a value of 0 clears
+// the association. The key is only compared by its address, so it's usually the address of a package-level variable.
+// This attaches data to objects of classes that can't be subclassed.
+func (id ID) SetAssociatedObject(key unsafe.Pointer, value ID, policy AssociationPolicy) {
+	objc_setAssociatedObject(id, key, value, policy)
+}
+
+// AssociatedObject returns the value associated with the object for key or 0 if there isn't one.
+func (id ID) AssociatedObject(key unsafe.Pointer) ID {
+	return objc_getAssociatedObject(id, key)
+}
+
+// RemoveAssociatedObjects removes all the associations of the object including those set by other code.
+// Prefer clearing a single association with SetAssociatedObject.
+func (id ID) RemoveAssociatedObjects() {
+	objc_removeAssociatedObjects(id)
+}
+
 // keep in sync with func.go
 const maxRegAllocStructSize = 16
 
@@ -124,18 +217,92 @@ const maxRegAllocStructSize = 16
 // This function takes a SEL instead of a string since RegisterName grabs the global Objective-C lock.
 // It is best to cache the result of RegisterName.
 func Send[T any](id ID, sel SEL, args ...any) T {
+	ret := reflect.TypeOf((*T)(nil)).Elem()
+	if fn, ok := sendFuncs.Load(ret); ok {
+		return fn.(func(id ID, sel SEL, args ...any) T)(id, sel, args...)
+	}
 	var fn func(id ID, sel SEL, args ...any) T
-	var zero T
-	if runtime.GOARCH == "amd64" &&
-		reflect.ValueOf(zero).Kind() == reflect.Struct &&
-		reflect.ValueOf(zero).Type().Size() > maxRegAllocStructSize {
+	if isStret(ret) {
 		purego.RegisterFunc(&fn, objc_msgSend_stret_fn)
 	} else {
 		purego.RegisterFunc(&fn, objc_msgSend_fn)
 	}
+	sendFuncs.Store(ret, fn)
 	return fn(id, sel, args...)
 }
 
+// sendFuncs and sendSuperFuncs map a result type to the function that Send and SendSuper registered for it.
+var sendFuncs, sendSuperFuncs sync.Map
+
+// isStret reports whether a result of type ret is returned through memory by objc_msgSend_stret.
+func isStret(ret reflect.Type) bool {
+	return runtime.GOARCH == "amd64" && ret.Kind() == reflect.Struct && ret.Size() > maxRegAllocStructSize
+}
+
+// BindMethods sets every function field with an objc tag of the struct that methods points to,
+// to a function that sends the message with the selector in the tag. The first argument of each function
+// is the object that receives the message. The other arguments and the return value are passed the same way
+// as with purego.RegisterFunc, so unlike Send, struct and float arguments are placed correctly. Fields without
+// an objc tag are left unchanged.
+//
+//	var NSString struct {
+//		Length           func(self objc.ID) uint           `objc:"length"`
+//		CharacterAtIndex func(self objc.ID, i uint) uint16 `objc:"characterAtIndex:"`
+//	}
+//	objc.BindMethods(&NSString)
+//	n := NSString.Length(str)
+//
+// The selectors are registered once by BindMethods. It panics if methods isn't a pointer to a struct
+// or if a tagged field isn't an exported function that takes an ID as its first argument.
+func BindMethods(methods any) {
+	v := reflect.ValueOf(methods)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		panic("objc: methods must be a pointer to a struct")
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, ok := field.Tag.Lookup("objc")
+		if !ok {
+			continue
+		}
+		ty := field.Type
+		if !field.IsExported() || ty.Kind() != reflect.Func || ty.NumIn() < 1 || ty.In(0) != reflect.TypeOf(ID(0)) {
+			panic("objc: field " + field.Name + " must be an exported function that takes an ID as its first argument; got " + ty.String())
+		}
+		v.Field(i).Set(bindMethod(ty, RegisterName(name)))
+	}
+}
+
+// bindMethod returns a function of type ty that calls objc_msgSend with sel inserted after the receiver.
+func bindMethod(ty reflect.Type, sel SEL) reflect.Value {
+	in := []reflect.Type{ty.In(0), reflect.TypeOf(SEL(0))}
+	for i := 1; i < ty.NumIn(); i++ {
+		in = append(in, ty.In(i))
+	}
+	out := make([]reflect.Type, ty.NumOut())
+	for i := range out {
+		out[i] = ty.Out(i)
+	}
+	msgSend := reflect.New(reflect.FuncOf(in, out, ty.IsVariadic()))
+	if ty.NumOut() == 1 && isStret(ty.Out(0)) {
+		purego.RegisterFunc(msgSend.Interface(), objc_msgSend_stret_fn)
+	} else {
+		purego.RegisterFunc(msgSend.Interface(), objc_msgSend_fn)
+	}
+	msgSend = msgSend.Elem()
+	cmd := reflect.ValueOf(sel)
+	return reflect.MakeFunc(ty, func(args []reflect.Value) []reflect.Value {
+		sendArgs := make([]reflect.Value, 0, len(args)+1)
+		sendArgs = append(sendArgs, args[0], cmd)
+		sendArgs = append(sendArgs, args[1:]...)
+		if ty.IsVariadic() {
+			return msgSend.CallSlice(sendArgs)
+		}
+		return msgSend.Call(sendArgs)
+	})
+}
+
 // objc_super data structure is generated by the Objective-C compiler when it encounters the super keyword
 // as the receiver of a message. It specifies the class definition of the particular superclass that should
 // be messaged.
@@ -163,18 +330,45 @@ func SendSuper[T any](id ID, sel SEL, args ...any) T {
 		receiver:   id,
 		superClass: id.Class(),
 	}
+	ret := reflect.TypeOf((*T)(nil)).Elem()
+	if fn, ok := sendSuperFuncs.Load(ret); ok {
+		return fn.(func(objcSuper *objc_super, sel SEL, args ...any) T)(super, sel, args...)
+	}
 	var fn func(objcSuper *objc_super, sel SEL, args ...any) T
-	var zero T
-	if runtime.GOARCH == "amd64" &&
-		reflect.ValueOf(zero).Kind() == reflect.Struct &&
-		reflect.ValueOf(zero).Type().Size() > maxRegAllocStructSize {
+	if isStret(ret) {
 		purego.RegisterFunc(&fn, objc_msgSendSuper2_stret_fn)
 	} else {
 		purego.RegisterFunc(&fn, objc_msgSendSuper2_fn)
 	}
+	sendSuperFuncs.Store(ret, fn)
 	return fn(super, sel, args...)
 }
 
+// CallIMP calls the method implementation imp with self and sel followed by args and returns its result
+// as any type, like Send does for a message. It doesn't look up the method, so it is faster than Send
+// when the same method is called often. The arguments are passed the same way as with Send.
+// For typed arguments, imp can also be registered with purego.RegisterFunc using a function
+// that takes an ID and a SEL as its first two arguments.
+func CallIMP[T any](imp IMP, self ID, sel SEL, args ...any) T {
+	key := callIMPKey{imp, reflect.TypeOf((*T)(nil)).Elem()}
+	if fn, ok := callIMPFuncs.Load(key); ok {
+		return fn.(func(self ID, sel SEL, args ...any) T)(self, sel, args...)
+	}
+	var fn func(self ID, sel SEL, args ...any) T
+	purego.RegisterFunc(&fn, uintptr(imp))
+	callIMPFuncs.Store(key, fn)
+	return fn(self, sel, args...)
+}
+
+// callIMPKey is an imp and the result type that CallIMP registered a function for.
+type callIMPKey struct {
+	imp IMP
+	ret reflect.Type
+}
+
+// callIMPFuncs maps a callIMPKey to the function that calls the imp.
+var callIMPFuncs sync.Map
+
 // SEL is an opaque type that represents a method selector
 type SEL uintptr
 
@@ -499,6 +693,14 @@ func (c Class) AddMethod(name SEL, imp IMP, types string) bool {
 	return class_addMethod(c, name, imp, types)
 }
 
+// MethodImplementation returns the function pointer that is called when an instance of the class receives
+// the message name. If instances of the class don't respond to it, the returned IMP forwards the message instead.
+// The IMP can be kept and called with CallIMP to skip the method lookup of objc_msgSend, as long as the method
+// isn't replaced afterwards.
+func (c Class) MethodImplementation(name SEL) IMP {
+	return class_getMethodImplementation(c, name)
+}
+
 // AddProtocol adds a protocol to a class.
 // Returns true if the protocol was added successfully, otherwise false (for example,
 // the class already conforms to that protocol).
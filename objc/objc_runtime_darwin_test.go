@@ -6,7 +6,9 @@ package objc_test
 import (
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"unsafe"
 
 	"github.com/ebitengine/purego"
 	"github.com/ebitengine/purego/objc"
@@ -93,6 +95,36 @@ func ExampleIMP() {
 	// Output: IMP: 105 567 9 2 3 -5 4 8 9
 }
 
+func ExampleCallIMP() {
+	sel_add := objc.RegisterName("add:to:")
+	class, err := objc.RegisterClass(
+		"AdderObject",
+		objc.GetClass("NSObject"),
+		nil,
+		nil,
+		[]objc.MethodDef{
+			{
+				Cmd: sel_add,
+				Fn: func(self objc.ID, _cmd objc.SEL, a, b int) int {
+					return a + b
+				},
+			},
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	object := objc.ID(class).Send(objc.RegisterName("new"))
+	imp := class.MethodImplementation(sel_add)
+	fmt.Println(objc.CallIMP[int](imp, object, sel_add, 2, 3))
+	// the second call reuses the function that the first one registered
+	fmt.Println(objc.CallIMP[int](imp, object, sel_add, 4, 5))
+	// Output:
+	// 5
+	// 9
+}
+
 func ExampleID_SendSuper() {
 	super, err := objc.RegisterClass(
 		"SuperObject",
@@ -152,6 +184,187 @@ func TestSend(t *testing.T) {
 	}
 }
 
+func TestSendFormat(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	class := objc.ID(objc.GetClass("NSString"))
+	stringWithUTF8String := objc.RegisterName("stringWithUTF8String:")
+	format := class.Send(stringWithUTF8String, "%@ %d %.2f %.1f %s %c %lld\x00")
+	name := class.Send(stringWithUTF8String, "purego\x00")
+	str := class.SendFormat(objc.RegisterName("stringWithFormat:"), format, name, int32(-7), 2.5, float32(0.5), "go", 'x', int64(1)<<40)
+	got := objc.Send[string](str, objc.RegisterName("UTF8String"))
+	if want := "purego -7 2.50 0.5 go x 1099511627776"; got != want {
+		t.Errorf("stringWithFormat: returned %q wanted %q", got, want)
+	}
+}
+
+func TestBindMethods(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var NSString struct {
+		StringWithUTF8String func(class objc.ID, s string) objc.ID   `objc:"stringWithUTF8String:"`
+		Length               func(self objc.ID) uint                 `objc:"length"`
+		CharacterAtIndex     func(self objc.ID, i uint) uint16       `objc:"characterAtIndex:"`
+		DoubleValue          func(self objc.ID) float64              `objc:"doubleValue"`
+		HasPrefix            func(self objc.ID, prefix objc.ID) bool `objc:"hasPrefix:"`
+		unbound              func()
+	}
+	objc.BindMethods(&NSString)
+	if NSString.unbound != nil {
+		t.Errorf("BindMethods set a field without an objc tag")
+	}
+
+	class := objc.ID(objc.GetClass("NSString"))
+	str := NSString.StringWithUTF8String(class, "2.5 purego")
+	if got := NSString.Length(str); got != 10 {
+		t.Errorf("length returned %d wanted %d", got, 10)
+	}
+	if got := NSString.CharacterAtIndex(str, 4); got != 'p' {
+		t.Errorf("characterAtIndex: returned %q wanted %q", rune(got), 'p')
+	}
+	if got := NSString.DoubleValue(str); got != 2.5 {
+		t.Errorf("doubleValue returned %v wanted %v", got, 2.5)
+	}
+	if !NSString.HasPrefix(str, NSString.StringWithUTF8String(class, "2.5")) {
+		t.Errorf("hasPrefix: returned false wanted true")
+	}
+}
+
+func TestCGRect(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var NSValue struct {
+		ValueWithRect func(class objc.ID, rect objc.CGRect) objc.ID `objc:"valueWithRect:"`
+		RectValue     func(self objc.ID) objc.CGRect                `objc:"rectValue"`
+		ValueWithSize func(class objc.ID, size objc.CGSize) objc.ID `objc:"valueWithSize:"`
+		SizeValue     func(self objc.ID) objc.CGSize                `objc:"sizeValue"`
+	}
+	objc.BindMethods(&NSValue)
+	class := objc.ID(objc.GetClass("NSValue"))
+
+	want := objc.CGRect{Origin: objc.CGPoint{X: 1.5, Y: -2}, Size: objc.CGSize{Width: 640, Height: 480.25}}
+	if got := NSValue.RectValue(NSValue.ValueWithRect(class, want)); got != want {
+		t.Errorf("rectValue returned %+v wanted %+v", got, want)
+	}
+	size := objc.CGSize{Width: 3, Height: 4.5}
+	if got := NSValue.SizeValue(NSValue.ValueWithSize(class, size)); got != size {
+		t.Errorf("sizeValue returned %+v wanted %+v", got, size)
+	}
+}
+
+var associatedObjectKey byte
+
+func TestAssociatedObject(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		sel_new           = objc.RegisterName("new")
+		sel_numberWithInt = objc.RegisterName("numberWithInt:")
+		sel_intValue      = objc.RegisterName("intValue")
+		key               = unsafe.Pointer(&associatedObjectKey)
+		object            = objc.ID(objc.GetClass("NSObject")).Send(sel_new)
+		number            = objc.ID(objc.GetClass("NSNumber")).Send(sel_numberWithInt, int32(42))
+	)
+	if got := object.AssociatedObject(key); got != 0 {
+		t.Fatalf("AssociatedObject returned %#x before it was set", got)
+	}
+	object.SetAssociatedObject(key, number, objc.AssociationRetainNonatomic)
+	if got := object.AssociatedObject(key); got != number {
+		t.Fatalf("AssociatedObject returned %#x wanted %#x", got, number)
+	}
+	if got := objc.Send[int32](object.AssociatedObject(key), sel_intValue); got != 42 {
+		t.Errorf("intValue of the associated object returned %d wanted %d", got, 42)
+	}
+	object.RemoveAssociatedObjects()
+	if got := object.AssociatedObject(key); got != 0 {
+		t.Errorf("AssociatedObject returned %#x after RemoveAssociatedObjects", got)
+	}
+}
+
+func TestNSArrayToSlice(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		sel_new           = objc.RegisterName("new")
+		sel_addObject     = objc.RegisterName("addObject:")
+		sel_numberWithInt = objc.RegisterName("numberWithInt:")
+		sel_intValue      = objc.RegisterName("intValue")
+		sel_release       = objc.RegisterName("release")
+		class_NSNumber    = objc.ID(objc.GetClass("NSNumber"))
+	)
+	if got := objc.NSArrayToSlice(0); got != nil {
+		t.Errorf("NSArrayToSlice(nil) returned %v wanted nil", got)
+	}
+	array := objc.ID(objc.GetClass("NSMutableArray")).Send(sel_new)
+	defer array.Send(sel_release)
+	if got := objc.NSArrayToSlice(array); len(got) != 0 {
+		t.Errorf("NSArrayToSlice of an empty array returned %v", got)
+	}
+	for i := int32(0); i < 3; i++ {
+		array.Send(sel_addObject, class_NSNumber.Send(sel_numberWithInt, i*10))
+	}
+	objects := objc.NSArrayToSlice(array)
+	if len(objects) != 3 {
+		t.Fatalf("NSArrayToSlice returned %d objects wanted 3", len(objects))
+	}
+	for i, object := range objects {
+		if got, want := objc.Send[int32](object, sel_intValue), int32(i*10); got != want {
+			t.Errorf("object %d has intValue %d wanted %d", i, got, want)
+		}
+	}
+}
+
+func TestSendConcurrent(t *testing.T) {
+	_, err := purego.Dlopen("/System/Library/Frameworks/Foundation.framework/Foundation", purego.RTLD_GLOBAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		class_NSNumber  = objc.ID(objc.GetClass("NSNumber"))
+		sel_alloc       = objc.RegisterName("alloc")
+		sel_initWithInt = objc.RegisterName("initWithInt:")
+		sel_intValue    = objc.RegisterName("intValue")
+		sel_release     = objc.RegisterName("release")
+	)
+	const (
+		goroutines = 8
+		iterations = 1000
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				want := int32(i*iterations + j)
+				number := class_NSNumber.Send(sel_alloc).Send(sel_initWithInt, want)
+				got := objc.Send[int32](number, sel_intValue)
+				number.Send(sel_release)
+				if got != want {
+					errs <- fmt.Errorf("intValue returned %d wanted %d", got, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
 func ExampleSend() {
 	type NSRange struct {
 		Location, Range uint
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"strconv"
+	"unsafe"
+)
+
+// RegisterLibFuncOut is a wrapper around RegisterFuncOut that uses the C function returned from Dlsym(handle, name).
+// It panics if it can't find the name symbol.
+func RegisterLibFuncOut(fptr any, handle uintptr, name string, outs int) {
+	// the decorated name of a __stdcall function also counts the out-parameters
+	cfnType := outFuncType(reflect.ValueOf(fptr).Elem().Type(), outs)
+	sym, err := loadFuncSymbol(handle, name, reflect.New(cfnType).Interface())
+	if err != nil {
+		panic(err)
+	}
+	registerFuncOut(fptr, sym, name, outs)
+}
+
+// RegisterFuncOut is like RegisterFunc but the last outs return values of fptr are read from out-parameters
+// of the C function instead. They are passed as pointers after the arguments of fptr in the same order, so
+// a return value of type T is a T* parameter in C. The memory they point to is allocated for each call and
+// what the C function stored there is returned. The return value of the C function, if there is one, comes before them:
+//
+//	// void get_size(int *w, int *h);
+//	var getSize func() (w, h int32)
+//	purego.RegisterFuncOut(&getSize, sym, 2)
+//
+//	// bool get_item_size(int id, int *w, int *h);
+//	var getItemSize func(id int32) (ok bool, w, h int32)
+//	purego.RegisterFuncOut(&getItemSize, sym, 2)
+//
+// The out-parameters must be of a type that C can write into, like the integers, floats, pointers and structs
+// of them, and fptr can't be variadic. Otherwise, the rules of RegisterFunc apply to the function
+// with the pointers added.
+func RegisterFuncOut(fptr any, cfn uintptr, outs int) {
+	registerFuncOut(fptr, cfn, "", outs)
+}
+
+func registerFuncOut(fptr any, cfn uintptr, name string, outs int) {
+	fn := reflect.ValueOf(fptr).Elem()
+	ty := fn.Type()
+	cfnValue := reflect.New(outFuncType(ty, outs))
+	// the function with the pointers is never passed to C
+	registerFunc(cfnValue.Interface(), cfn, name, false)
+	call := cfnValue.Elem()
+	numRet := ty.NumOut() - outs
+	v := reflect.MakeFunc(ty, func(args []reflect.Value) []reflect.Value {
+		ptrs := make([]reflect.Value, outs)
+		for i := range ptrs {
+			ptrs[i] = reflect.New(ty.Out(numRet + i))
+			args = append(args, ptrs[i])
+		}
+		results := call.Call(args)
+		for _, ptr := range ptrs {
+			results = append(results, ptr.Elem())
+		}
+		return results
+	})
+	fn.Set(v)
+}
+
+// outFuncType returns the type of the C function that a function of type ty with outs out-parameters calls.
+func outFuncType(ty reflect.Type, outs int) reflect.Type {
+	if ty.Kind() != reflect.Func {
+		panic("purego: fptr must be a function pointer")
+	}
+	if outs < 0 || outs > ty.NumOut() {
+		panic("purego: " + ty.String() + " doesn't have " + strconv.Itoa(outs) + " return values")
+	}
+	if ty.IsVariadic() {
+		panic("purego: out-parameters can't follow variadic arguments")
+	}
+	// the C function is called with a pointer for each out-parameter after the arguments
+	numRet := ty.NumOut() - outs
+	ins := make([]reflect.Type, 0, ty.NumIn()+outs)
+	for i := 0; i < ty.NumIn(); i++ {
+		ins = append(ins, ty.In(i))
+	}
+	rets := make([]reflect.Type, 0, numRet)
+	for i := 0; i < ty.NumOut(); i++ {
+		if i < numRet {
+			rets = append(rets, ty.Out(i))
+			continue
+		}
+		switch k := ty.Out(i).Kind(); k {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+			panic("purego: unsupported out-parameter type " + k.String())
+		}
+		ins = append(ins, reflect.PointerTo(ty.Out(i)))
+	}
+	return reflect.FuncOf(ins, rets, false)
+}
+
+// sliceHeader is the memory layout of a slice.
+type sliceHeader struct {
+	data     unsafe.Pointer
+	len, cap int
+}
+
+// registerSliceFunc sets fn, which returns a CSlice, to call the C function cfn that returns a pointer
+// to the first element and writes the number of elements to a size_t* after the arguments of fn.
+func registerSliceFunc(fn reflect.Value, cfn uintptr, name string) {
+	ty := fn.Type()
+	if ty.IsVariadic() {
+		panic("purego: a slice can't be returned from a variadic function")
+	}
+	ins := make([]reflect.Type, ty.NumIn())
+	for i := range ins {
+		ins[i] = ty.In(i)
+	}
+	call := reflect.New(reflect.FuncOf(ins, []reflect.Type{reflect.TypeOf(unsafe.Pointer(nil)), reflect.TypeOf(Size(0))}, false))
+	registerFuncOut(call.Interface(), cfn, name, 1)
+	fn.Set(reflect.MakeFunc(ty, func(args []reflect.Value) []reflect.Value {
+		results := call.Elem().Call(args)
+		s := reflect.New(ty.Out(0))
+		if ptr := results[0].UnsafePointer(); ptr != nil {
+			n := int(results[1].Uint())
+			*(*sliceHeader)(s.UnsafePointer()) = sliceHeader{data: ptr, len: n, cap: n}
+		}
+		return []reflect.Value{s.Elem()}
+	}))
+}
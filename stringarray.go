@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/ebitengine/purego/internal/strings"
+)
+
+// StringArray is a slice of strings that is passed to a C function as a NULL-terminated array
+// of null-terminated char* like the argv of execv. The array is copied into C memory that is freed
+// after the call, so C must not keep it. When it is a return value, the NULL-terminated char** that
+// the C function returns is copied with GoStrings.
+//
+//	// int execv(const char *path, char *const argv[]);
+//	var execv func(path string, argv purego.StringArray) int32
+type StringArray []string
+
+var stringArrayType = reflect.TypeOf(StringArray(nil))
+
+// CStringArray copies ss into a NULL-terminated array of null-terminated char* in C memory that can be
+// passed to C code and kept by it. The array and the strings stay valid until release is called.
+//
+//	argv, release := purego.CStringArray([]string{"ls", "-l"})
+//	defer release()
+func CStringArray(ss []string) (array **byte, release func()) {
+	const ptrSize = unsafe.Sizeof(uintptr(0))
+	arr := unsafe.Slice((**byte)(cMalloc(uintptr(len(ss)+1)*ptrSize)), len(ss)+1)
+	for i, s := range ss {
+		p := unsafe.Slice((*byte)(cMalloc(uintptr(len(s)+1))), len(s)+1)
+		copy(p, s)
+		p[len(s)] = 0
+		arr[i] = &p[0]
+	}
+	arr[len(ss)] = nil
+	return &arr[0], func() {
+		for _, p := range arr[:len(ss)] {
+			cFree(unsafe.Pointer(p))
+		}
+		cFree(unsafe.Pointer(&arr[0]))
+	}
+}
+
+// GoStrings copies the strings of the NULL-terminated array of null-terminated char* that ptr points to,
+// like environ, to a []string. It returns nil if ptr is 0. Neither the array nor the strings are freed.
+func GoStrings(ptr uintptr) []string {
+	// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+	p := *(*unsafe.Pointer)(unsafe.Pointer(&ptr))
+	if p == nil {
+		return nil
+	}
+	ss := []string{}
+	for ; *(*uintptr)(p) != 0; p = unsafe.Add(p, unsafe.Sizeof(uintptr(0))) {
+		ss = append(ss, strings.GoString(*(*uintptr)(p)))
+	}
+	return ss
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"unsafe"
+)
+
+// structField is a field of a struct that is neither a struct nor an array
+// together with its offset from the start of the outermost struct.
+type structField struct {
+	typ    reflect.Type
+	offset uintptr
+}
+
+// value returns the field of the struct that ptr points to.
+func (f structField) value(ptr unsafe.Pointer) reflect.Value {
+	return reflect.NewAt(f.typ, unsafe.Add(ptr, f.offset)).Elem()
+}
+
+// structFields returns the fields of the struct type t in memory order where the fields of nested structs
+// and the elements of arrays are expanded in place. The calling conventions classify a struct by these fields,
+// so the code of every architecture uses them to decide where a struct is placed and only applies its own rules.
+func structFields(t reflect.Type) []structField {
+	return appendStructFields(nil, t, 0)
+}
+
+func appendStructFields(fields []structField, t reflect.Type, offset uintptr) []structField {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fields = appendStructFields(fields, f.Type, offset+f.Offset)
+		}
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			fields = appendStructFields(fields, t.Elem(), offset+uintptr(i)*t.Elem().Size())
+		}
+	default:
+		fields = append(fields, structField{typ: t, offset: offset})
+	}
+	return fields
+}
+
+// copyStruct returns a pointer to a copy of the struct v so that its fields can be read using structFields.
+func copyStruct(v reflect.Value) unsafe.Pointer {
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.UnsafePointer()
+}
+
+// structWords returns the size bytes that ptr points to as 8-byte words where the last word is padded with zeros.
+// Since this copies the memory the words have the byte order of the platform, which is how registers are
+// loaded with a struct.
+func structWords(ptr unsafe.Pointer, size uintptr) []uintptr {
+	if size == 0 {
+		return nil
+	}
+	words := make([]uintptr, (size+7)/8)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*8), unsafe.Slice((*byte)(ptr), size))
+	return words
+}
+
+// ArgClass is where a part of a struct argument is placed by the C calling convention.
+type ArgClass int
+
+const (
+	ArgInteger   ArgClass = iota + 1 // an integer register
+	ArgFloat                         // a floating-point register
+	ArgStack                         // an 8-byte slot on the stack
+	ArgReference                     // a copy of the whole struct is made and a pointer to it is passed like an integer
+)
+
+func (c ArgClass) String() string {
+	switch c {
+	case ArgInteger:
+		return "INTEGER"
+	case ArgFloat:
+		return "FLOAT"
+	case ArgStack:
+		return "STACK"
+	case ArgReference:
+		return "REFERENCE"
+	}
+	return "ArgClass(" + strconv.Itoa(int(c)) + ")"
+}
+
+// ClassifyStruct returns where each part of a struct of type t is placed when it is the first argument of
+// a function registered with RegisterFunc. It has an ArgInteger or ArgFloat for each register that is used
+// in the order they are filled, or an ArgStack for each 8-byte slot on the stack, or a single ArgReference
+// if the struct is passed as a pointer to a copy. A struct of size 0 isn't passed at all and returns nil.
+//
+// This places the struct exactly like a call does without calling anything, so that tests can check that
+// the Go definition of a struct is passed the same way as the C one:
+//
+//	// struct { double x; int64_t y; } is passed in one float and one integer register on amd64
+//	classes := purego.ClassifyStruct(reflect.TypeOf(struct {
+//		X float64
+//		Y int64
+//	}{}))
+//	// classes is []ArgClass{ArgFloat, ArgInteger}
+//
+// On Windows amd64 a struct of 1, 2, 4 or 8 bytes is a single ArgInteger, even if it has float fields,
+// and any other struct is an ArgReference.
+//
+// It panics if t isn't a struct or if structs aren't supported as arguments on the platform.
+func ClassifyStruct(t reflect.Type) []ArgClass {
+	if t.Kind() != reflect.Struct {
+		panic("purego: ClassifyStruct of non-struct type " + t.String())
+	}
+	checkStructArgsSupported()
+	var classes []ArgClass
+	var ints, floats, stack int
+	numInts := numOfIntegerRegisters()
+	if runtime.GOOS == "windows" {
+		// only the first 4 argument slots are registers
+		numInts = 4
+	}
+	// these mirror the functions that place the arguments when the function is called
+	addStack := func(uintptr) {
+		stack++
+		classes = append(classes, ArgStack)
+	}
+	addInt := func(uintptr) {
+		if ints < numInts {
+			ints++
+			classes = append(classes, ArgInteger)
+		} else {
+			addStack(0)
+		}
+	}
+	addFloat := func(uintptr) {
+		if floats < numOfFloats {
+			floats++
+			classes = append(classes, ArgFloat)
+		} else {
+			addStack(0)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		// integers and floats share the argument slots
+		addFloat = addInt
+	}
+	if keepAlive := addStruct(reflect.New(t).Elem(), &ints, &floats, &stack, addInt, addFloat, addStack, nil); len(keepAlive) > 0 {
+		// only a copy of the struct is kept alive
+		return []ArgClass{ArgReference}
+	}
+	return classes
+}
@@ -4,8 +4,8 @@
 package purego
 
 import (
-	"math"
 	"reflect"
+	"runtime"
 	"unsafe"
 )
 
@@ -14,46 +14,21 @@ func getStruct(outType reflect.Type, syscall syscall15Args) (v reflect.Value) {
 	switch {
 	case outSize == 0:
 		return reflect.New(outType).Elem()
-	case outSize <= 8:
-		if isAllFloats(outType) {
-			// 2 float32s or 1 float64s are return in the float register
-			return reflect.NewAt(outType, unsafe.Pointer(&struct{ a uintptr }{syscall.f1})).Elem()
-		}
-		// up to 8 bytes is returned in RAX
-		return reflect.NewAt(outType, unsafe.Pointer(&struct{ a uintptr }{syscall.a1})).Elem()
 	case outSize <= 16:
-		r1, r2 := syscall.a1, syscall.a2
-		if isAllFloats(outType) {
-			r1 = syscall.f1
-			r2 = syscall.f2
-		} else {
-			// check first 8 bytes if it's floats
-			hasFirstFloat := false
-			f1 := outType.Field(0).Type
-			if f1.Kind() == reflect.Float64 || f1.Kind() == reflect.Float32 && outType.Field(1).Type.Kind() == reflect.Float32 {
-				r1 = syscall.f1
-				hasFirstFloat = true
-			}
-
-			// find index of the field that starts the second 8 bytes
-			var i int
-			for i = 0; i < outType.NumField(); i++ {
-				if outType.Field(i).Offset == 8 {
-					break
-				}
-			}
-
-			// check last 8 bytes if they are floats
-			f1 = outType.Field(i).Type
-			if f1.Kind() == reflect.Float64 || f1.Kind() == reflect.Float32 && i+1 == outType.NumField() {
-				r2 = syscall.f1
-			} else if hasFirstFloat {
-				// if the first field was a float then that means the second integer field
-				// comes from the first integer register
-				r2 = syscall.a1
+		// each eightbyte is returned in the next register of its class
+		// so RAX and RDX for INTEGER and XMM0 and XMM1 for SSE
+		ints := []uintptr{syscall.a1, syscall.a2}
+		floats := []uintptr{syscall.f1, syscall.f2}
+		var words [2]uintptr
+		classes := classifyEightbytes(outType)
+		for i := range words[:(outSize+7)/8] {
+			if classes[i] == _SSE {
+				words[i], floats = floats[0], floats[1:]
+			} else {
+				words[i], ints = ints[0], ints[1:]
 			}
 		}
-		return reflect.NewAt(outType, unsafe.Pointer(&struct{ a, b uintptr }{r1, r2})).Elem()
+		return reflect.NewAt(outType, unsafe.Pointer(&words)).Elem()
 	default:
 		// create struct from the Go pointer created above
 		// weird pointer dereference to circumvent go vet
@@ -61,18 +36,6 @@ func getStruct(outType reflect.Type, syscall syscall15Args) (v reflect.Value) {
 	}
 }
 
-func isAllFloats(ty reflect.Type) bool {
-	for i := 0; i < ty.NumField(); i++ {
-		f := ty.Field(i)
-		switch f.Type.Kind() {
-		case reflect.Float64, reflect.Float32:
-		default:
-			return false
-		}
-	}
-	return true
-}
-
 // https://refspecs.linuxbase.org/elf/x86_64-abi-0.99.pdf
 // https://gitlab.com/x86-psABIs/x86-64-ABI
 // Class determines where the 8 byte value goes.
@@ -89,6 +52,9 @@ func addStruct(v reflect.Value, numInts, numFloats, numStack *int, addInt, addFl
 	if v.Type().Size() == 0 {
 		return keepAlive
 	}
+	if runtime.GOOS == "windows" {
+		return addStructWindows(v, addInt, keepAlive)
+	}
 
 	// if greater than 64 bytes place on stack
 	if v.Type().Size() > 8*8 {
@@ -100,7 +66,7 @@ func addStruct(v reflect.Value, numInts, numFloats, numStack *int, addInt, addFl
 		savedNumInts   = *numInts
 		savedNumStack  = *numStack
 	)
-	placeOnStack := postMerger(v.Type()) || !tryPlaceRegister(v, addFloat, addInt)
+	placeOnStack := postMerger(v.Type()) || !tryPlaceRegister(v, *numInts, *numFloats, addFloat, addInt)
 	if placeOnStack {
 		// reset any values placed in registers
 		*numFloats = savedNumFloats
@@ -111,6 +77,33 @@ func addStruct(v reflect.Value, numInts, numFloats, numStack *int, addInt, addFl
 	return keepAlive
 }
 
+// addStructWindows places v according to the Microsoft x64 calling convention.
+// https://learn.microsoft.com/en-us/cpp/build/x64-calling-convention#parameter-passing
+func addStructWindows(v reflect.Value, addInt func(uintptr), keepAlive []any) []any {
+	for _, f := range structFields(v.Type()) {
+		switch f.typ.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Pointer, reflect.UnsafePointer:
+		default:
+			panic("purego: unsupported kind " + f.typ.Kind().String())
+		}
+	}
+	size := v.Type().Size()
+	ptr := copyStruct(v)
+	switch size {
+	case 1, 2, 4, 8:
+		// structs that are the size of an integer are passed like one
+		// even if their fields are floats.
+		addInt(structWords(ptr, size)[0])
+	default:
+		// all other structs are passed as a pointer to a copy that the callee may modify
+		keepAlive = append(keepAlive, ptr)
+		addInt(uintptr(ptr))
+	}
+	return keepAlive
+}
+
 func postMerger(t reflect.Type) (passInMemory bool) {
 	// (c) If the size of the aggregate exceeds two eightbytes and the first eight- byte isn’t SSE or any other
 	// eightbyte isn’t SSEUP, the whole argument is passed in memory.
@@ -123,138 +116,62 @@ func postMerger(t reflect.Type) (passInMemory bool) {
 	return true // Go does not have an SSE/SSEUP type so this is always true
 }
 
-func tryPlaceRegister(v reflect.Value, addFloat func(uintptr), addInt func(uintptr)) (ok bool) {
-	ok = true
-	var val uint64
-	var shift byte // # of bits to shift
-	var flushed bool
-	class := _NO_CLASS
-	flushIfNeeded := func() {
-		if flushed {
-			return
+// classifyEightbytes returns the class of each eightbyte of a struct of at most 16 bytes. Every field that overlaps
+// an eightbyte is merged into its class, so it is SSE if all of them are floats and INTEGER if any of them isn't.
+// An eightbyte without fields is NO_CLASS.
+func classifyEightbytes(t reflect.Type) (classes [2]int) {
+	for _, f := range structFields(t) {
+		var class int
+		switch f.typ.Kind() {
+		case reflect.Float32, reflect.Float64:
+			class = _SSE
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Pointer, reflect.UnsafePointer:
+			class = _INTEGER
+		default:
+			panic("purego: unsupported kind " + f.typ.Kind().String())
 		}
-		flushed = true
-		if class == _SSE {
-			addFloat(uintptr(val))
+		// a field is never larger than 8 bytes and is aligned to its size so it is inside of a single eightbyte
+		classes[f.offset/8] |= class
+	}
+	return classes
+}
+
+func tryPlaceRegister(v reflect.Value, numInts, numFloats int, addFloat func(uintptr), addInt func(uintptr)) (ok bool) {
+	// pointers, including named pointer types, are INTEGER like any other integer so they don't force the struct
+	// onto the stack. What they point to is kept alive by the struct in the arguments of the call like the memory
+	// of a pointer argument, so the copy of the struct that the eightbytes are read from doesn't need to be.
+	classes := classifyEightbytes(v.Type())
+	words := structWords(copyStruct(v), v.Type().Size())
+	// If there aren't enough registers left for all the eightbytes the whole struct is passed on the stack
+	// and the registers are left for the arguments that follow it.
+	var needInts, needFloats int
+	for i := range words {
+		if classes[i] == _SSE {
+			needFloats++
 		} else {
-			addInt(uintptr(val))
+			needInts++
 		}
-		val = 0
-		shift = 0
-		class = _NO_CLASS
 	}
-	var place func(v reflect.Value)
-	place = func(v reflect.Value) {
-		var numFields int
-		if v.Kind() == reflect.Struct {
-			numFields = v.Type().NumField()
+	if numInts+needInts > numOfIntegerRegisters() || numFloats+needFloats > numOfFloats {
+		return false
+	}
+	// The eightbytes are read from the memory of the struct instead of being assembled from the fields
+	// so that they have the byte order of the platform.
+	for i, word := range words {
+		if classes[i] == _SSE {
+			addFloat(word)
 		} else {
-			numFields = v.Type().Len()
-		}
-
-		for i := 0; i < numFields; i++ {
-			flushed = false
-			var f reflect.Value
-			if v.Kind() == reflect.Struct {
-				f = v.Field(i)
-			} else {
-				f = v.Index(i)
-			}
-			switch f.Kind() {
-			case reflect.Struct:
-				place(f)
-			case reflect.Bool:
-				if f.Bool() {
-					val |= 1
-				}
-				shift += 8
-				class |= _INTEGER
-			case reflect.Pointer:
-				ok = false
-				return
-			case reflect.Int8:
-				val |= uint64(f.Int()&0xFF) << shift
-				shift += 8
-				class |= _INTEGER
-			case reflect.Int16:
-				val |= uint64(f.Int()&0xFFFF) << shift
-				shift += 16
-				class |= _INTEGER
-			case reflect.Int32:
-				val |= uint64(f.Int()&0xFFFF_FFFF) << shift
-				shift += 32
-				class |= _INTEGER
-			case reflect.Int64, reflect.Int:
-				val = uint64(f.Int())
-				shift = 64
-				class = _INTEGER
-			case reflect.Uint8:
-				val |= f.Uint() << shift
-				shift += 8
-				class |= _INTEGER
-			case reflect.Uint16:
-				val |= f.Uint() << shift
-				shift += 16
-				class |= _INTEGER
-			case reflect.Uint32:
-				val |= f.Uint() << shift
-				shift += 32
-				class |= _INTEGER
-			case reflect.Uint64, reflect.Uint:
-				val = f.Uint()
-				shift = 64
-				class = _INTEGER
-			case reflect.Float32:
-				val |= uint64(math.Float32bits(float32(f.Float()))) << shift
-				shift += 32
-				class |= _SSE
-			case reflect.Float64:
-				if v.Type().Size() > 16 {
-					ok = false
-					return
-				}
-				val = uint64(math.Float64bits(f.Float()))
-				shift = 64
-				class = _SSE
-			case reflect.Array:
-				place(f)
-			default:
-				panic("purego: unsupported kind " + f.Kind().String())
-			}
-
-			if shift == 64 {
-				flushIfNeeded()
-			} else if shift > 64 {
-				// Should never happen, but may if we forget to reset shift after flush (or forget to flush),
-				// better fall apart here, than corrupt arguments.
-				panic("purego: tryPlaceRegisters shift > 64")
-			}
+			addInt(word)
 		}
 	}
-
-	place(v)
-	flushIfNeeded()
-	return ok
+	return true
 }
 
 func placeStack(v reflect.Value, addStack func(uintptr)) {
-	for i := 0; i < v.Type().NumField(); i++ {
-		f := v.Field(i)
-		switch f.Kind() {
-		case reflect.Pointer:
-			addStack(f.Pointer())
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			addStack(uintptr(f.Int()))
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			addStack(uintptr(f.Uint()))
-		case reflect.Float32:
-			addStack(uintptr(math.Float32bits(float32(f.Float()))))
-		case reflect.Float64:
-			addStack(uintptr(math.Float64bits(f.Float())))
-		case reflect.Struct:
-			placeStack(f, addStack)
-		default:
-			panic("purego: unsupported kind " + f.Kind().String())
-		}
+	// a struct on the stack has the same layout as in memory with each eightbyte in its own slot
+	for _, w := range structWords(copyStruct(v), v.Type().Size()) {
+		addStack(w)
 	}
 }
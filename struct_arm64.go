@@ -58,141 +58,65 @@ func getStruct(outType reflect.Type, syscall syscall15Args) (v reflect.Value) {
 	}
 }
 
-// https://github.com/ARM-software/abi-aa/blob/main/sysvabi64/sysvabi64.rst
-const (
-	_NO_CLASS = 0b00
-	_FLOAT    = 0b01
-	_INT      = 0b11
-)
-
 func addStruct(v reflect.Value, numInts, numFloats, numStack *int, addInt, addFloat, addStack func(uintptr), keepAlive []any) []any {
 	if v.Type().Size() == 0 {
 		return keepAlive
 	}
 
-	if hva, hfa, size := isHVA(v.Type()), isHFA(v.Type()), v.Type().Size(); hva || hfa || size <= 16 {
-		// if this doesn't fit entirely in registers then
-		// each element goes onto the stack
-		if hfa && *numFloats+v.NumField() > numOfFloats {
+	// Go doesn't have short vector types so a struct is never an HVA and only HFAs are passed in float registers.
+	if hfa, size := isHFA(v.Type()), v.Type().Size(); hfa || size <= 16 {
+		// if this doesn't fit entirely in registers then no later argument
+		// of the same kind uses a register either (C.3 and C.13 in [Arm64 Calling Convention])
+		if hfa && *numFloats+len(structFields(v.Type())) > numOfFloats {
 			*numFloats = numOfFloats
-		} else if hva && *numInts+v.NumField() > numOfIntegerRegisters() {
+			// an HFA on the stack has the same layout as in memory instead of a slot for each member
+			for _, word := range structWords(copyStruct(v), size) {
+				addStack(word)
+			}
+			return keepAlive
+		} else if !hfa && *numInts+int(roundUpTo8(size)/8) > numOfIntegerRegisters() {
 			*numInts = numOfIntegerRegisters()
 		}
 
 		placeRegisters(v, addFloat, addInt)
 	} else {
-		keepAlive = placeStack(v, keepAlive, addInt)
+		// Any other struct larger than 16 bytes is copied to memory and replaced by a pointer to the copy
+		// no matter how large it is or what its fields are (B.4 in [Arm64 Calling Convention]).
+		keepAlive = placeReference(v, keepAlive, addInt)
 	}
-	return keepAlive // the struct was allocated so don't panic
+	return keepAlive
 }
 
 func placeRegisters(v reflect.Value, addFloat func(uintptr), addInt func(uintptr)) {
-	var val uint64
-	var shift byte
-	var flushed bool
-	class := _NO_CLASS
-	var place func(v reflect.Value)
-	place = func(v reflect.Value) {
-		var numFields int
-		if v.Kind() == reflect.Struct {
-			numFields = v.Type().NumField()
-		} else {
-			numFields = v.Type().Len()
-		}
-		for k := 0; k < numFields; k++ {
-			flushed = false
-			var f reflect.Value
-			if v.Kind() == reflect.Struct {
-				f = v.Field(k)
-			} else {
-				f = v.Index(k)
-			}
-			if shift >= 64 {
-				shift = 0
-				flushed = true
-				if class == _FLOAT {
-					addFloat(uintptr(val))
-				} else {
-					addInt(uintptr(val))
-				}
-			}
-			switch f.Type().Kind() {
-			case reflect.Struct:
-				place(f)
-			case reflect.Bool:
-				if f.Bool() {
-					val |= 1
-				}
-				shift += 8
-				class |= _INT
-			case reflect.Uint8:
-				val |= f.Uint() << shift
-				shift += 8
-				class |= _INT
-			case reflect.Uint16:
-				val |= f.Uint() << shift
-				shift += 16
-				class |= _INT
-			case reflect.Uint32:
-				val |= f.Uint() << shift
-				shift += 32
-				class |= _INT
-			case reflect.Uint64:
-				addInt(uintptr(f.Uint()))
-				shift = 0
-				flushed = true
-			case reflect.Int8:
-				val |= uint64(f.Int()&0xFF) << shift
-				shift += 8
-				class |= _INT
-			case reflect.Int16:
-				val |= uint64(f.Int()&0xFFFF) << shift
-				shift += 16
-				class |= _INT
-			case reflect.Int32:
-				val |= uint64(f.Int()&0xFFFF_FFFF) << shift
-				shift += 32
-				class |= _INT
-			case reflect.Int64:
-				addInt(uintptr(f.Int()))
-				shift = 0
-				flushed = true
+	ptr := copyStruct(v)
+	if isHFA(v.Type()) {
+		// each member of an HFA is placed in its own float register
+		for _, field := range structFields(v.Type()) {
+			switch f := field.value(ptr); f.Kind() {
 			case reflect.Float32:
-				if class == _FLOAT {
-					addFloat(uintptr(val))
-					val = 0
-					shift = 0
-				}
-				val |= uint64(math.Float32bits(float32(f.Float()))) << shift
-				shift += 32
-				class |= _FLOAT
+				addFloat(uintptr(math.Float32bits(float32(f.Float()))))
 			case reflect.Float64:
-				addFloat(uintptr(math.Float64bits(float64(f.Float()))))
-				shift = 0
-				flushed = true
-			case reflect.Array:
-				place(f)
+				addFloat(uintptr(math.Float64bits(f.Float())))
 			default:
 				panic("purego: unsupported kind " + f.Kind().String())
 			}
 		}
+		return
 	}
-	place(v)
-	if !flushed {
-		if class == _FLOAT {
-			addFloat(uintptr(val))
-		} else {
-			addInt(uintptr(val))
-		}
+	// Any other composite type that is at most 16 bytes is passed in integer registers as if
+	// it was loaded from memory (B.4 and C.10 in [Arm64 Calling Convention]). Copying the memory of the struct
+	// places the fields of nested structs and arrays the same way as the fields of the outer struct. Pointers
+	// are copied as plain integers; the struct that is passed in keeps the memory they point to alive during the call.
+	//
+	// [Arm64 Calling Convention]: https://github.com/ARM-software/abi-aa/blob/main/sysvabi64/sysvabi64.rst
+	for _, word := range structWords(ptr, v.Type().Size()) {
+		addInt(word)
 	}
 }
 
-func placeStack(v reflect.Value, keepAlive []any, addInt func(uintptr)) []any {
-	// Struct is too big to be placed in registers.
-	// Copy to heap and place the pointer in register
-	ptrStruct := reflect.New(v.Type())
-	ptrStruct.Elem().Set(v)
-	ptr := ptrStruct.Elem().Addr().UnsafePointer()
+func placeReference(v reflect.Value, keepAlive []any, addInt func(uintptr)) []any {
+	// the callee may modify the copy so it can't be the memory of v
+	ptr := copyStruct(v)
 	keepAlive = append(keepAlive, ptr)
 	addInt(uintptr(ptr))
 	return keepAlive
@@ -206,69 +130,22 @@ func placeStack(v reflect.Value, keepAlive []any, addInt func(uintptr)) []any {
 func isHFA(t reflect.Type) bool {
 	// round up struct size to nearest 8 see section B.4
 	structSize := roundUpTo8(t.Size())
-	if structSize == 0 || t.NumField() > 4 {
+	if structSize == 0 {
 		return false
 	}
-	first := t.Field(0)
-	switch first.Type.Kind() {
-	case reflect.Float32, reflect.Float64:
-		firstKind := first.Type.Kind()
-		for i := 0; i < t.NumField(); i++ {
-			if t.Field(i).Type.Kind() != firstKind {
-				return false
-			}
-		}
-		return true
-	case reflect.Array:
-		switch first.Type.Elem().Kind() {
-		case reflect.Float32, reflect.Float64:
-			return true
-		default:
-			return false
-		}
-	case reflect.Struct:
-		for i := 0; i < first.Type.NumField(); i++ {
-			if !isHFA(first.Type) {
-				return false
-			}
-		}
-		return true
-	default:
+	// the members of nested structs and arrays count as members of the outer struct
+	fields := structFields(t)
+	if len(fields) > 4 {
 		return false
 	}
-}
-
-// isHVA reports a Homogeneous Aggregate with a Fundamental Data Type that is a Short-Vector type
-// and at most four uniquely addressable members (5.9.5.2 in [Arm64 Calling Convention]).
-// A short vector is a machine type that is composed of repeated instances of one fundamental integral or
-// floating-point type. It may be 8 or 16 bytes in total size (5.4 in [Arm64 Calling Convention]).
-// This type of struct will be placed more compactly than the individual fields.
-//
-// [Arm64 Calling Convention]: https://github.com/ARM-software/abi-aa/blob/main/sysvabi64/sysvabi64.rst
-func isHVA(t reflect.Type) bool {
-	// round up struct size to nearest 8 see section B.4
-	structSize := roundUpTo8(t.Size())
-	if structSize == 0 || (structSize != 8 && structSize != 16) {
+	first := fields[0].typ.Kind()
+	if first != reflect.Float32 && first != reflect.Float64 {
 		return false
 	}
-	first := t.Field(0)
-	switch first.Type.Kind() {
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Int8, reflect.Int16, reflect.Int32:
-		firstKind := first.Type.Kind()
-		for i := 0; i < t.NumField(); i++ {
-			if t.Field(i).Type.Kind() != firstKind {
-				return false
-			}
-		}
-		return true
-	case reflect.Array:
-		switch first.Type.Elem().Kind() {
-		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Int8, reflect.Int16, reflect.Int32:
-			return true
-		default:
+	for _, f := range fields {
+		if f.typ.Kind() != first {
 			return false
 		}
-	default:
-		return false
 	}
+	return true
 }
@@ -1,7 +1,7 @@
 // SPDX-License-Identifier: Apache-2.0
 // SPDX-FileCopyrightText: 2024 The Ebitengine Authors
 
-//go:build darwin && (arm64 || amd64)
+//go:build (darwin && (arm64 || amd64)) || (linux && amd64)
 
 package purego_test
 
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"unsafe"
 
@@ -410,6 +411,20 @@ func TestRegisterFunc_structArgs(t *testing.T) {
 			t.Fatalf("BoolStructFn returned %v wanted %v", ret, false)
 		}
 	}
+	{
+		type CharBool struct {
+			c int8
+			b bool
+		}
+		var CharBoolFn func(CharBool) int32
+		purego.RegisterLibFunc(&CharBoolFn, lib, "CharBool")
+		if ret := CharBoolFn(CharBool{c: 12, b: true}); ret != 12 {
+			t.Fatalf("CharBoolFn returned %d wanted %d", ret, 12)
+		}
+		if ret := CharBoolFn(CharBool{c: 12, b: false}); ret != -12 {
+			t.Fatalf("CharBoolFn returned %d wanted %d", ret, -12)
+		}
+	}
 	{
 		type BoolFloat struct {
 			b bool
@@ -441,6 +456,227 @@ func TestRegisterFunc_structArgs(t *testing.T) {
 			t.Fatalf("InitWithContentRect returned %d wanted %#x", ret, expectedUnsigned)
 		}
 	}
+	{
+		type point struct{ x, y float32 }
+		type TaggedPoint struct {
+			point point
+			tag   int32
+		}
+		var TaggedPointFn func(TaggedPoint) int32
+		purego.RegisterLibFunc(&TaggedPointFn, lib, "TaggedPoint")
+		const expected = 6*7 + 9
+		if ret := TaggedPointFn(TaggedPoint{point{6, 7}, 9}); ret != expected {
+			t.Fatalf("TaggedPointFn returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		// an embedded struct is passed like the nested struct of C
+		type point struct{ x, y float32 }
+		type TaggedPoint struct {
+			point
+			tag int32
+		}
+		var TaggedPointFn func(TaggedPoint) int32
+		purego.RegisterLibFunc(&TaggedPointFn, lib, "TaggedPoint")
+		const expected = 6*7 + 9
+		if ret := TaggedPointFn(TaggedPoint{point{6, 7}, 9}); ret != expected {
+			t.Fatalf("TaggedPointFn returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		type Point struct{ X, Y float64 }
+		type Size struct{ Width, Height float64 }
+		type Content struct {
+			Point
+			Size
+		}
+		var InitWithContentRect func(*int, Content, int32, int32, bool) uint64
+		purego.RegisterLibFunc(&InitWithContentRect, lib, "InitWithContentRect")
+		const expected = (10 + 20 + 30 + 40) / (3 - 1)
+		if ret := InitWithContentRect(new(int), Content{Point{10, 20}, Size{30, 40}}, 3, 1, true); ret != expected {
+			t.Fatalf("InitWithContentRect returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		type point struct{ x, y float64 }
+		type TwoPoints struct {
+			a, b point
+		}
+		var TwoPointsFn func(a, b, c, d, e, f float64, p TwoPoints) float64
+		purego.RegisterLibFunc(&TwoPointsFn, lib, "TwoPoints")
+		const expected = 1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9 + 10
+		if ret := TwoPointsFn(1, 2, 3, 4, 5, 6, TwoPoints{point{7, 8}, point{9, 10}}); ret != expected {
+			t.Fatalf("TwoPointsFn returned %f wanted %f", ret, float64(expected))
+		}
+	}
+	if runtime.GOARCH == "arm64" {
+		// amd64 passes a struct with pointer fields on the stack instead of in registers
+		type ByteSlice struct {
+			data *byte
+			len  int
+		}
+		var ByteSliceFn func(ByteSlice) int
+		purego.RegisterLibFunc(&ByteSliceFn, lib, "ByteSlice")
+		b := []byte("banana")
+		if ret := ByteSliceFn(ByteSlice{&b[0], len(b)}); ret != 3 {
+			t.Fatalf("ByteSliceFn returned %d wanted %d", ret, 3)
+		}
+
+		type UnsafeByteSlice struct {
+			data unsafe.Pointer
+			len  int
+		}
+		var UnsafeByteSliceFn func(UnsafeByteSlice) int
+		purego.RegisterLibFunc(&UnsafeByteSliceFn, lib, "ByteSlice")
+		if ret := UnsafeByteSliceFn(UnsafeByteSlice{unsafe.Pointer(&b[0]), len(b) - 1}); ret != 2 {
+			t.Fatalf("UnsafeByteSliceFn returned %d wanted %d", ret, 2)
+		}
+	}
+	{
+		type Opaque12 struct {
+			_ [12]byte
+		}
+		type Opaque24 struct {
+			_ [24]byte
+		}
+		var Opaque12Fn func(Opaque12) int
+		purego.RegisterLibFunc(&Opaque12Fn, lib, "Opaque12")
+		var Opaque24Fn func(Opaque24) int
+		purego.RegisterLibFunc(&Opaque24Fn, lib, "Opaque24")
+		var (
+			b        [24]byte
+			expected int
+		)
+		for i := range b {
+			b[i] = byte(i + 1)
+			expected += (i + 1) * (i + 1)
+			if i == 11 {
+				o := *(*Opaque12)(unsafe.Pointer(&b))
+				if ret := Opaque12Fn(o); ret != expected {
+					t.Fatalf("Opaque12Fn returned %d wanted %d", ret, expected)
+				}
+			}
+		}
+		if ret := Opaque24Fn(*(*Opaque24)(unsafe.Pointer(&b))); ret != expected {
+			t.Fatalf("Opaque24Fn returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		type Mixed32 struct {
+			A int64
+			B float64
+			C int32
+			D float32
+			E int64
+		}
+		var Mixed32Fn func(Mixed32) float64
+		purego.RegisterLibFunc(&Mixed32Fn, lib, "Mixed32")
+		const expected = 1 + 2*2.5 + 3*-3 + 4*4.25 + 5*5
+		if ret := Mixed32Fn(Mixed32{1, 2.5, -3, 4.25, 5}); ret != expected {
+			t.Fatalf("Mixed32Fn returned %f wanted %f", ret, expected)
+		}
+	}
+	{
+		type FourFloats struct {
+			A, B, C, D float32
+		}
+		var FourFloatsAfterRegs func(a1, a2, a3, a4, a5, a6 float64, f FourFloats) float32
+		purego.RegisterLibFunc(&FourFloatsAfterRegs, lib, "FourFloatsAfterRegs")
+		const expected = 1 + 2 + 3 + 4 + 5 + 6 + 1.5 + 2*2.5 + 3*3.5 + 4*4.5
+		if ret := FourFloatsAfterRegs(1, 2, 3, 4, 5, 6, FourFloats{1.5, 2.5, 3.5, 4.5}); ret != expected {
+			t.Fatalf("FourFloatsAfterRegs returned %f wanted %f", ret, expected)
+		}
+	}
+	{
+		type FloatsInt64 struct {
+			A, B float32
+			C    int64
+		}
+		var FloatsInt64Fn func(FloatsInt64) float64
+		purego.RegisterLibFunc(&FloatsInt64Fn, lib, "FloatsInt64")
+		const expected = 1.5 + 2*2.5 + 3*-3
+		if ret := FloatsInt64Fn(FloatsInt64{1.5, 2.5, -3}); ret != expected {
+			t.Fatalf("FloatsInt64Fn returned %f wanted %f", ret, expected)
+		}
+	}
+	{
+		type FloatInt32Double struct {
+			A float32
+			B int32
+			C float64
+		}
+		var FloatInt32DoubleFn func(FloatInt32Double) float64
+		purego.RegisterLibFunc(&FloatInt32DoubleFn, lib, "FloatInt32Double")
+		const expected = 1.5 + 2*-2 + 3*3.5
+		if ret := FloatInt32DoubleFn(FloatInt32Double{1.5, -2, 3.5}); ret != expected {
+			t.Fatalf("FloatInt32DoubleFn returned %f wanted %f", ret, expected)
+		}
+	}
+	{
+		type TwoInt64 struct {
+			A, B int64
+		}
+		var TwoInt64AfterInts func(a1, a2, a3, a4, a5 int64, s TwoInt64, a6 int64) int64
+		purego.RegisterLibFunc(&TwoInt64AfterInts, lib, "TwoInt64AfterInts")
+		const expected = 1 + 2*2 + 3*3 + 4*4 + 5*5 + 6*6 + 7*7 + 8*8
+		if ret := TwoInt64AfterInts(1, 2, 3, 4, 5, TwoInt64{6, 7}, 8); ret != expected {
+			t.Fatalf("TwoInt64AfterInts returned %d wanted %d", ret, expected)
+		}
+	}
+	{
+		type Big struct {
+			A [6]int64
+			B [3]float64
+		}
+		var BigStruct func(a1 int64, s Big, f1 float64, a2 int64) float64
+		purego.RegisterLibFunc(&BigStruct, lib, "BigStruct")
+		const expected = 1 + 2*2.5 + 3*3 + 4*4 + 5*5 + 6*6 + 7*7 + 8*8 + 9*9 + 10*10.5 + 11*11.5 + 12*12.5
+		if ret := BigStruct(1, Big{[6]int64{4, 5, 6, 7, 8, 9}, [3]float64{10.5, 11.5, 12.5}}, 2.5, 3); ret != expected {
+			t.Fatalf("BigStruct returned %f wanted %f", ret, expected)
+		}
+	}
+	{
+		type Handle struct {
+			P namedPointer
+		}
+		var DerefHandle func(Handle) int64
+		purego.RegisterLibFunc(&DerefHandle, lib, "DerefHandle")
+		value := int64(expectedSigned)
+		if ret := DerefHandle(Handle{&value}); ret != expectedSigned {
+			t.Fatalf("DerefHandle returned %d wanted %d", ret, expectedSigned)
+		}
+	}
+	{
+		type Buffer struct {
+			Data *int64
+			Len  int32
+		}
+		var SumBuffer func(Buffer) int64
+		purego.RegisterLibFunc(&SumBuffer, lib, "SumBuffer")
+		data := []int64{1, 2, 3, 4}
+		if ret := SumBuffer(Buffer{&data[0], int32(len(data))}); ret != 10 {
+			t.Fatalf("SumBuffer returned %d wanted %d", ret, 10)
+		}
+		var SumBufferAfterInts func(a1, a2, a3, a4, a5 int64, b Buffer, a6 int64) int64
+		purego.RegisterLibFunc(&SumBufferAfterInts, lib, "SumBufferAfterInts")
+		if ret := SumBufferAfterInts(1, 2, 3, 4, 5, Buffer{&data[0], int32(len(data))}, 6); ret != 31 {
+			t.Fatalf("SumBufferAfterInts returned %d wanted %d", ret, 31)
+		}
+	}
+	{
+		type GUID struct {
+			Data1        uint32
+			Data2, Data3 uint16
+			Data4        [8]byte
+		}
+		var GUIDSum func(float64, GUID, float32) uint64
+		purego.RegisterLibFunc(&GUIDSum, lib, "GUIDSum")
+		guid := GUID{0xdeadbeef, 0xcafe, 0xbabe, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		const expected = 0xdeadbeef + 0xcafe + 0xbabe + 100 + 20 + 1 + 2<<1 + 3<<2 + 4<<3 + 5<<4 + 6<<5 + 7<<6 + 8<<7
+		if ret := GUIDSum(100, guid, 20); ret != expected {
+			t.Fatalf("GUIDSum returned %#x wanted %#x", ret, uint64(expected))
+		}
+	}
 	{
 		type GoInt4 struct {
 			A, B, C, D int
@@ -465,6 +701,32 @@ func TestRegisterFunc_structArgs(t *testing.T) {
 	}
 }
 
+func TestRegisterFunc_structGoFields(t *testing.T) {
+	type withSlice struct {
+		data []byte
+		n    int
+	}
+	type withString struct {
+		s string
+	}
+	for name, fptr := range map[string]any{
+		"slice argument":  new(func(withSlice) int),
+		"string argument": new(func(withString) int),
+		"slice return":    new(func() withSlice),
+	} {
+		func() {
+			defer func() {
+				r, _ := recover().(string)
+				if !strings.Contains(r, "use a pointer field instead") {
+					t.Errorf("registering a struct %s with a Go only field panicked with %q", name, r)
+				}
+			}()
+			// the function is never called
+			purego.RegisterFunc(fptr, 1)
+		}()
+	}
+}
+
 func TestRegisterFunc_structReturns(t *testing.T) {
 	libFileName := filepath.Join(t.TempDir(), "structreturntest.so")
 	t.Logf("Build %v", libFileName)
@@ -736,4 +998,61 @@ func TestRegisterFunc_structReturns(t *testing.T) {
 		runtime.KeepAlive(a)
 		runtime.KeepAlive(b)
 	}
+	{
+		type FloatsInt64 struct {
+			a, b float32
+			c    int64
+		}
+		var ReturnFloatsInt64 func(a, b float32, c int64) FloatsInt64
+		purego.RegisterLibFunc(&ReturnFloatsInt64, lib, "ReturnFloatsInt64")
+		expected := FloatsInt64{1.5, 2.5, -3}
+		if ret := ReturnFloatsInt64(1.5, 2.5, -3); ret != expected {
+			t.Fatalf("ReturnFloatsInt64 returned %+v wanted %+v", ret, expected)
+		}
+	}
+	{
+		type FloatInt32Double struct {
+			a float32
+			b int32
+			c float64
+		}
+		var ReturnFloatInt32Double func(a float32, b int32, c float64) FloatInt32Double
+		purego.RegisterLibFunc(&ReturnFloatInt32Double, lib, "ReturnFloatInt32Double")
+		expected := FloatInt32Double{1.5, -2, 3.5}
+		if ret := ReturnFloatInt32Double(1.5, -2, 3.5); ret != expected {
+			t.Fatalf("ReturnFloatInt32Double returned %+v wanted %+v", ret, expected)
+		}
+	}
+	{
+		var ReturnQuaternion func(x, y, z, w float32) [4]float32
+		purego.RegisterLibFunc(&ReturnQuaternion, lib, "ReturnQuaternion")
+		expected := [4]float32{1, 2, 3, 4}
+		if ret := ReturnQuaternion(1, 2, 3, 4); ret != expected {
+			t.Fatalf("ReturnQuaternion returned %+v wanted %+v", ret, expected)
+		}
+	}
+	{
+		var ReturnThreeLongs func(a, b, c int64) [3]int64
+		purego.RegisterLibFunc(&ReturnThreeLongs, lib, "ReturnThreeLongs")
+		expected := [3]int64{1, 2, 3}
+		if ret := ReturnThreeLongs(1, 2, 3); ret != expected {
+			t.Fatalf("ReturnThreeLongs returned %+v wanted %+v", ret, expected)
+		}
+	}
+	{
+		type Large128 struct {
+			a [8]int64
+			b [8]float64
+		}
+		var ReturnLarge128 func(start int64, scale float64) Large128
+		purego.RegisterLibFunc(&ReturnLarge128, lib, "ReturnLarge128")
+		var expected Large128
+		for i := range expected.a {
+			expected.a[i] = -5 + int64(i)
+			expected.b[i] = 1.5 * float64(i)
+		}
+		if ret := ReturnLarge128(-5, 1.5); ret != expected {
+			t.Fatalf("ReturnLarge128 returned %+v wanted %+v", ret, expected)
+		}
+	}
 }
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build windows && amd64
+
+package purego_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ebitengine/purego"
+)
+
+// buildDLL builds the C sources into a DLL with the C compiler of go env CC and loads it.
+func buildDLL(t *testing.T, sources ...string) uintptr {
+	out, err := exec.Command("go", "env", "CC").Output()
+	if err != nil {
+		t.Fatalf("go env CC error: %v", err)
+	}
+	cc := strings.TrimSpace(string(out))
+	if cc == "" {
+		t.Skip("no C compiler")
+	}
+	dll := filepath.Join(t.TempDir(), "test.dll")
+	args := append([]string{"-shared", "-Wall", "-Werror", "-o", dll}, sources...)
+	if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+		t.Fatalf("compile error: %v\n%s", err, out)
+	}
+	handle, err := syscall.LoadLibrary(dll)
+	if err != nil {
+		t.Fatalf("LoadLibrary(%q) failed: %v", dll, err)
+	}
+	t.Cleanup(func() { syscall.FreeLibrary(handle) })
+	return uintptr(handle)
+}
+
+func TestRegisterFunc_structArgsWindows(t *testing.T) {
+	lib := buildDLL(t, filepath.Join("testdata", "structtest", "struct_windows_test.c"))
+
+	type IntFloat8 struct {
+		A int32
+		B float32
+	}
+	type Int12 struct{ A, B, C int32 }
+	t.Run("register", func(t *testing.T) {
+		type Bytes1 struct{ A uint8 }
+		type Bytes2 struct{ A, B uint8 }
+		type Float4 struct{ A float32 }
+		var bytes1 func(Bytes1) int64
+		var bytes2 func(Bytes2) int64
+		var float4 func(Float4) int64
+		var intFloat8 func(IntFloat8) int64
+		purego.RegisterLibFunc(&bytes1, lib, "Bytes1")
+		purego.RegisterLibFunc(&bytes2, lib, "Bytes2")
+		purego.RegisterLibFunc(&float4, lib, "Float4")
+		purego.RegisterLibFunc(&intFloat8, lib, "IntFloat8")
+		if got := bytes1(Bytes1{7}); got != 7 {
+			t.Errorf("Bytes1 returned %d wanted %d", got, 7)
+		}
+		if got := bytes2(Bytes2{3, 4}); got != 3+2*4 {
+			t.Errorf("Bytes2 returned %d wanted %d", got, 3+2*4)
+		}
+		// a struct of one float is still passed in an integer register
+		if got := float4(Float4{2.5}); got != 25 {
+			t.Errorf("Float4 returned %d wanted %d", got, 25)
+		}
+		if got := intFloat8(IntFloat8{-3, 1.5}); got != -3+15 {
+			t.Errorf("IntFloat8 returned %d wanted %d", got, -3+15)
+		}
+	})
+	t.Run("reference", func(t *testing.T) {
+		type Bytes3 struct{ A, B, C uint8 }
+		type Double16 struct{ A, B float64 }
+		var bytes3 func(Bytes3) int64
+		var int12 func(Int12) int64
+		var double16 func(Double16) int64
+		purego.RegisterLibFunc(&bytes3, lib, "Bytes3")
+		purego.RegisterLibFunc(&int12, lib, "Int12")
+		purego.RegisterLibFunc(&double16, lib, "Double16")
+		// the callee modifies its copy which must not change the struct of the caller
+		b3 := Bytes3{1, 2, 3}
+		if got := bytes3(b3); got != 1+2*2+3*3 || b3 != (Bytes3{1, 2, 3}) {
+			t.Errorf("Bytes3 returned %d and left %+v wanted %d and {1 2 3}", got, b3, 1+2*2+3*3)
+		}
+		i12 := Int12{4, 5, 6}
+		if got := int12(i12); got != 4+2*5+3*6 || i12 != (Int12{4, 5, 6}) {
+			t.Errorf("Int12 returned %d and left %+v wanted %d and {4 5 6}", got, i12, 4+2*5+3*6)
+		}
+		d16 := Double16{1.5, 2.5}
+		if got := double16(d16); got != 15+250 || d16 != (Double16{1.5, 2.5}) {
+			t.Errorf("Double16 returned %d and left %+v wanted %d and {1.5 2.5}", got, d16, 15+250)
+		}
+	})
+	t.Run("stack", func(t *testing.T) {
+		var structsOnStack func(a1 int64, a2 float64, a3, a4 int64, s IntFloat8, r Int12, a7 int64) int64
+		purego.RegisterLibFunc(&structsOnStack, lib, "StructsOnStack")
+		const want = 1 + 25 + 3 + 4 + 5 + 65 + 7 + 8 + 9 + 10
+		if got := structsOnStack(1, 2.5, 3, 4, IntFloat8{5, 6.5}, Int12{7, 8, 9}, 10); got != want {
+			t.Errorf("StructsOnStack returned %d wanted %d", got, want)
+		}
+	})
+}
+
+func TestClassifyStruct_windows(t *testing.T) {
+	const (
+		I = purego.ArgInteger
+		R = purego.ArgReference
+	)
+	for _, test := range []struct {
+		name string
+		typ  reflect.Type
+		want []purego.ArgClass
+	}{
+		{"empty", reflect.TypeOf(struct{}{}), nil},
+		{"1 byte", reflect.TypeOf(struct{ A uint8 }{}), []purego.ArgClass{I}},
+		{"2 bytes", reflect.TypeOf(struct{ A, B uint8 }{}), []purego.ArgClass{I}},
+		{"3 bytes", reflect.TypeOf(struct{ A, B, C uint8 }{}), []purego.ArgClass{R}},
+		{"4 bytes", reflect.TypeOf(struct{ A float32 }{}), []purego.ArgClass{I}},
+		{"8 bytes", reflect.TypeOf(struct{ A, B float32 }{}), []purego.ArgClass{I}},
+		{"12 bytes", reflect.TypeOf(struct{ A, B, C int32 }{}), []purego.ArgClass{R}},
+		{"16 bytes", reflect.TypeOf(struct{ A, B float64 }{}), []purego.ArgClass{R}},
+	} {
+		if got := purego.ClassifyStruct(test.typ); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ClassifyStruct(%s) returned %v wanted %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// Symbols returns the sorted names of the symbols that the library with handle exports. These are the names
+// that Dlsym finds in it, so it helps to find out why a symbol isn't found or which functions a plugin has:
+//
+//	names, err := purego.Symbols(handle)
+//	if err != nil {
+//		panic(err)
+//	}
+//	for _, name := range names {
+//		fmt.Println(name)
+//	}
+//
+// The export table is read from the file of the library on Linux and FreeBSD, from the export trie of
+// the image in memory on macOS and from the export directory of the module in memory on Windows where handle
+// is the module handle. Only the names of exported functions and variables are returned, not of imported
+// or local symbols. It always returns an error on Android.
+func Symbols(handle uintptr) ([]string, error) {
+	names, err := loadSymbols(handle)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readAt returns the T at the address addr in memory that Go doesn't manage.
+func readAt[T any](addr uintptr) T {
+	// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+	return *(*T)(*(*unsafe.Pointer)(unsafe.Pointer(&addr)))
+}
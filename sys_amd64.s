@@ -8,6 +8,9 @@
 #include "go_asm.h"
 #include "funcdata.h"
 
+// the stack arguments a7 to a15 followed by the pointer to syscall15Args. It is a multiple of 16 so the stack
+// stays aligned after BP is pushed. Everything is stored above SP and nothing is left in the 128-byte red zone below
+// it, which a signal handler may overwrite at any time.
 #define STACK_SIZE 80
 #define PTR_ADDRESS (STACK_SIZE - 8)
 
@@ -42,7 +45,7 @@ TEXT syscall15X(SB), NOSPLIT|NOFRAME, $0
 	PUSHQ BP
 	MOVQ  SP, BP
 	SUBQ  $STACK_SIZE, SP
-	MOVQ  DI, PTR_ADDRESS(BP) // save the pointer
+	MOVQ  DI, PTR_ADDRESS(SP) // save the pointer
 	MOVQ  DI, R11
 
 	MOVQ syscall15Args_f1(R11), X0 // f1
@@ -80,17 +83,31 @@ TEXT syscall15X(SB), NOSPLIT|NOFRAME, $0
 	MOVQ R12, 56(SP)                 // push a14
 	MOVQ syscall15Args_a15(R11), R12
 	MOVQ R12, 64(SP)                 // push a15
-	XORL AX, AX                      // vararg: say "no float args"
+	MOVL $8, AX                      // vararg: the float arguments may be in any of the 8 float registers
 
 	MOVQ syscall15Args_fn(R11), R10 // fn
 	CALL R10
-
-	MOVQ PTR_ADDRESS(BP), DI      // get the pointer back
-	MOVQ AX, syscall15Args_a1(DI) // r1
-	MOVQ DX, syscall15Args_a2(DI) // r3
-	MOVQ X0, syscall15Args_f1(DI) // f1
-	MOVQ X1, syscall15Args_f2(DI) // f2
-
+	PUSHFQ   // save the flags before anything can change them
+	POPQ R10
+
+	MOVQ PTR_ADDRESS(SP), DI         // get the pointer back
+	MOVQ AX, syscall15Args_a1(DI)    // r1
+	MOVQ DX, syscall15Args_a2(DI)    // r3
+	MOVQ X0, syscall15Args_f1(DI)    // f1
+	MOVQ X1, syscall15Args_f2(DI)    // f2
+	MOVHPD X0, syscall15Args_f5(DI)  // upper half of X0 for M128
+	MOVQ R10, syscall15Args_flags(DI) // flags
+
+	// read errno on this thread before anything else can change it
+	MOVQ  syscall15Args_errno(DI), R10
+	TESTQ R10, R10
+	JZ    noerrno
+	CALL  R10                          // returns &errno
+	MOVLQSX (AX), AX
+	MOVQ  PTR_ADDRESS(SP), DI
+	MOVQ  AX, syscall15Args_errno(DI) // errno
+
+noerrno:
 	XORL AX, AX          // no error (it's ignored anyway)
 	ADDQ $STACK_SIZE, SP
 	MOVQ BP, SP
@@ -78,15 +78,28 @@ TEXT syscall15X(SB), NOSPLIT, $0
 
 	MOVD syscall15Args_fn(R9), R10 // fn
 	BL   (R10)
+	MRS  NZCV, R3 // save the flags before anything can change them
 
-	MOVD PTR_ADDRESS(RSP), R2 // pop structure pointer
-	ADD  $STACK_SIZE, RSP
+	MOVD PTR_ADDRESS(RSP), R2 // get structure pointer
 
-	MOVD  R0, syscall15Args_a1(R2) // save r1
-	MOVD  R1, syscall15Args_a2(R2) // save r3
+	MOVD  R0, syscall15Args_a1(R2)    // save r1
+	MOVD  R1, syscall15Args_a2(R2)    // save r3
+	MOVD  R3, syscall15Args_flags(R2) // save flags
 	FMOVD F0, syscall15Args_f1(R2) // save f0
 	FMOVD F1, syscall15Args_f2(R2) // save f1
 	FMOVD F2, syscall15Args_f3(R2) // save f2
 	FMOVD F3, syscall15Args_f4(R2) // save f3
+	VMOV  V0.D[1], R4
+	MOVD  R4, syscall15Args_f5(R2) // save the upper half of v0 for M128
 
+	// read errno on this thread before anything else can change it
+	MOVD syscall15Args_errno(R2), R10
+	CBZ  R10, noerrno
+	BL   (R10)                     // returns &errno
+	MOVW (R0), R0
+	MOVD PTR_ADDRESS(RSP), R2
+	MOVD R0, syscall15Args_errno(R2) // save errno
+
+noerrno:
+	ADD $STACK_SIZE, RSP // pop structure pointer
 	RET
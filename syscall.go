@@ -5,6 +5,13 @@
 
 package purego
 
+import (
+	"reflect"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
 // CDecl marks a function as being called using the __cdecl calling convention as defined in
 // the [MSDocs] when passed to NewCallback. It must be the first argument to the function.
 // This is only useful on 386 Windows, but it is safe to use on other platforms.
@@ -12,6 +19,194 @@ package purego
 // [MSDocs]: https://learn.microsoft.com/en-us/cpp/cpp/cdecl?view=msvc-170
 type CDecl struct{}
 
+// StructReturn is a pointer to the memory where a C function writes the struct it returns.
+// When it is the last argument of a function given to RegisterFunc, it is passed as the hidden
+// struct return pointer (in X8 on arm64 and as the first integer argument on other platforms)
+// instead of as a normal argument. This is an alternative to declaring the struct as the return value
+// and is only correct for structs that the C calling convention returns in memory, which on amd64 and arm64
+// are structs larger than 16 bytes (that aren't made of up to four floats on arm64).
+//
+//	// struct Matrix get_matrix(int id);
+//	var getMatrix func(id int32, ret purego.StructReturn)
+//	var m Matrix
+//	getMatrix(1, purego.StructReturn(unsafe.Pointer(&m)))
+type StructReturn unsafe.Pointer
+
+// Carry can be used as the second return value of a function registered with RegisterFunc
+// to get the state of the carry flag after the C function returns. This is only useful for functions
+// written in assembly that return a status in the carry flag since C functions never do.
+// The first return value must be an integer, bool or pointer.
+//
+//	// uint64_t add_with_carry(uint64_t a, uint64_t b);
+//	var addWithCarry func(a, b uint64) (uint64, purego.Carry)
+//
+// Carry is the CF flag on amd64 and the C flag on arm64. It's not supported on Windows amd64.
+type Carry bool
+
+var carryType = reflect.TypeOf(Carry(false))
+
+// carrySet reports whether the carry flag is set in flags.
+func carrySet(flags uintptr) bool {
+	if runtime.GOARCH == "arm64" {
+		return flags&(1<<29) != 0 // C is bit 29 of NZCV
+	}
+	return flags&1 != 0 // CF is bit 0 of RFLAGS
+}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	errnoType = reflect.TypeOf(syscall.Errno(0))
+)
+
+// Counted is a slice that is passed to a C function as two arguments: a pointer to its first element
+// followed by its length in elements. This matches the common (const T *data, size_t count) idiom of C.
+// The pointer is nil if the slice is empty. Both are integer arguments whatever T is, so a Counted[float32]
+// of vertices is passed like any other pointer and doesn't take float registers. A length that C declares
+// as an int instead of a size_t is read correctly as long as it fits in an int.
+//
+//	// void draw_points(const struct Point *points, size_t count);
+//	var drawPoints func(points purego.Counted[Point])
+//	drawPoints(purego.Counted[Point](points))
+type Counted[T any] []T
+
+func (c Counted[T]) counted() (ptr uintptr, n uintptr) {
+	if len(c) == 0 {
+		return 0, 0
+	}
+	return uintptr(unsafe.Pointer(&c[0])), uintptr(len(c))
+}
+
+// counted is implemented by every instantiation of Counted.
+type counted interface {
+	counted() (ptr uintptr, n uintptr)
+}
+
+var countedType = reflect.TypeOf((*counted)(nil)).Elem()
+
+// CSlice is a slice of C memory that a function returns as a pointer to the first element while it writes the
+// number of elements to a size_t* that is passed after the other arguments. The slice isn't copied so it is only
+// valid as long as the memory of the C function is, and it is nil if the C function returns NULL.
+//
+//	// const uint8_t *get_buffer(size_t *len);
+//	var getBuffer func() purego.CSlice[byte]
+type CSlice[T any] []T
+
+func (CSlice[T]) cSlice() {}
+
+// cSlice is implemented by every instantiation of CSlice.
+type cSlice interface {
+	cSlice()
+}
+
+var cSliceType = reflect.TypeOf((*cSlice)(nil)).Elem()
+
+// Size is the Go type of the C size_t. It is as wide as a pointer on every platform,
+// so it is 32 bits on 32-bit platforms and 64 bits on 64-bit platforms.
+type Size = uintptr
+
+// SSize is the Go type of the C ssize_t. It has the same width as Size.
+type SSize = int
+
+// CPtr is a pointer to C memory, like the memory returned by malloc, that is passed to and returned
+// from C functions as a void*. Since it is an integer to Go, the garbage collector neither scans nor
+// keeps alive what it points to and RegisterFunc passes it as is. This makes it clear which pointers
+// are managed by C, but it must never hold a pointer to Go memory as nothing would keep that memory alive.
+//
+//	// void *malloc(size_t size); void free(void *ptr);
+//	var malloc func(size purego.Size) purego.CPtr
+//	var free func(ptr purego.CPtr)
+type CPtr uintptr
+
+// Pointer returns p as an unsafe.Pointer so that the memory can be accessed from Go.
+func (p CPtr) Pointer() unsafe.Pointer {
+	// We take the address and then dereference it to trick go vet from creating a possible misuse of unsafe.Pointer
+	return *(*unsafe.Pointer)(unsafe.Pointer(&p))
+}
+
+// WinBool is the Go type of the Windows BOOL which is a 4-byte int and not a _Bool. FALSE is 0 and any other
+// value is TRUE, so a BOOL that is returned as a bool would miss a TRUE that only has bits set above the lowest byte.
+// Since it has the size of BOOL it can also be used for the fields of structs and the memory that pointers point to.
+//
+//	// BOOL IsWindowVisible(HWND hWnd);
+//	var isWindowVisible func(hwnd uintptr) purego.WinBool
+//	visible := isWindowVisible(hwnd).Bool()
+type WinBool int32
+
+// Bool reports whether b is TRUE.
+func (b WinBool) Bool() bool {
+	return b != 0
+}
+
+// M128 is a 128-bit SIMD vector like the __m128, __m128d and __m128i of SSE or the float32x4_t of NEON
+// that a C function returns in XMM0 on amd64 or V0 on arm64. It can only be a return value since vector
+// arguments can't be passed by RegisterFunc. Its bytes are in memory order, so the lanes can be read with
+// Float32s, Float64s or encoding/binary:
+//
+//	// __m128 add(const float *a, const float *b) { return _mm_add_ps(_mm_loadu_ps(a), _mm_loadu_ps(b)); }
+//	var add func(a, b *[4]float32) purego.M128
+//	sum := add(&a, &b).Float32s()
+//
+// M128 is supported on amd64 and arm64 but not on Windows amd64.
+type M128 [16]byte
+
+var m128Type = reflect.TypeOf(M128{})
+
+// Float32s returns the four float lanes of v like those of an __m128.
+func (v M128) Float32s() [4]float32 {
+	return *(*[4]float32)(unsafe.Pointer(&v))
+}
+
+// Float64s returns the two double lanes of v like those of an __m128d.
+func (v M128) Float64s() [2]float64 {
+	return *(*[2]float64)(unsafe.Pointer(&v))
+}
+
+// CallbackToChannel returns a C function pointer made by NewCallback that sends its only argument to ch,
+// for C APIs that deliver events or results by calling a callback, possibly from a thread of their own:
+//
+//	// void start_download(const char *url, void (*done)(int status));
+//	done := make(chan int32, 1)
+//	startDownload(url, purego.CallbackToChannel(done))
+//	status := <-done
+//
+// The C function pointer must take a single argument of type T and return nothing. The send blocks the thread
+// that calls it until the value is received, so use a buffered channel if the C code must not wait.
+// Like every callback made by NewCallback it is never freed, so create it once for each channel and not for each call.
+func CallbackToChannel[T any](ch chan<- T) uintptr {
+	if ch == nil {
+		panic("purego: ch is nil")
+	}
+	// the callback returns a value since NewCallback requires one on Windows, which is ignored by C
+	return NewCallback(func(v T) uintptr {
+		ch <- v
+		return 0
+	})
+}
+
+// CallThenOnSameThread calls call and then then on the same OS thread, which no other goroutine runs on in between.
+// Libraries like libdl and OpenSSL keep the error of the last call in a thread-local variable that is read by
+// another function, like dlerror and ERR_get_error, which is only correct on the thread that made the call.
+// A goroutine may move to another thread between two calls unless it is locked to the thread:
+//
+//	// void *dlopen(const char *path, int mode); char *dlerror(void);
+//	var handle uintptr
+//	var msg string
+//	purego.CallThenOnSameThread(func() {
+//		handle = dlopen(path, purego.RTLD_NOW)
+//	}, func() {
+//		if handle == 0 {
+//			msg = dlerror()
+//		}
+//	})
+//
+// The errno of a C function is read on the right thread by declaring it as a return value so it doesn't need this.
+func CallThenOnSameThread(call, then func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	call()
+	then()
+}
+
 const (
 	maxArgs     = 15
 	numOfFloats = 8 // arm64 and amd64 both have 8 float registers
@@ -21,6 +216,8 @@ type syscall15Args struct {
 	fn, a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14, a15 uintptr
 	f1, f2, f3, f4, f5, f6, f7, f8                                       uintptr
 	arm64_r8                                                             uintptr
+	flags                                                                uintptr // the flags register after the call
+	errno                                                                uintptr // the function that returns &errno before the call and errno after it
 }
 
 // SyscallN takes fn, a C function pointer and a list of arguments as uintptr.
@@ -19,7 +19,7 @@ func syscall_syscall15X(fn, a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a
 	args := syscall15Args{
 		fn, a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a13, a14, a15,
 		a1, a2, a3, a4, a5, a6, a7, a8,
-		0,
+		0, 0, 0,
 	}
 	runtime_cgocall(syscall15XABI0, unsafe.Pointer(&args))
 	return args.a1, args.a2, 0
@@ -29,8 +29,13 @@ func syscall_syscall15X(fn, a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a
 // This is useful when interoperating with C code requiring callbacks. The argument is expected to be a
 // function with zero or one uintptr-sized result. The function must not have arguments with size larger than the size
 // of uintptr. Only a limited number of callbacks may be created in a single Go process, and any memory allocated
-// for these callbacks is never released. At least 2000 callbacks can always be created. Although this function
-// provides similar functionality to windows.NewCallback it is distinct.
+// for these callbacks is never released. At least 2000 callbacks can always be created. The returned function
+// pointer is the C-callable address of fn and stays valid for the lifetime of the process, so it can be stored
+// and compared with the pointers that C hands back, and there is no function to release it. The callback
+// may call into C code that calls it or another callback again since the arguments of every call are read
+// from that call's own frame.
+// A Go value that C passes back to the callback as a void* must be passed as a Handle and not as a pointer.
+// Although this function provides similar functionality to windows.NewCallback it is distinct.
 func NewCallback(fn any) uintptr {
 	ty := reflect.TypeOf(fn)
 	for i := 0; i < ty.NumIn(); i++ {
@@ -4,8 +4,12 @@
 package purego
 
 import (
+	"errors"
 	"reflect"
 	"syscall"
+	"unsafe"
+
+	"github.com/ebitengine/purego/internal/strings"
 )
 
 var syscall15XABI0 uintptr
@@ -20,8 +24,11 @@ func syscall_syscall15X(fn, a1, a2, a3, a4, a5, a6, a7, a8, a9, a10, a11, a12, a
 // function with one uintptr-sized result. The function must not have arguments with size larger than the
 // size of uintptr. Only a limited number of callbacks may be created in a single Go process, and any memory
 // allocated for these callbacks is never released. Between NewCallback and NewCallbackCDecl, at least 1024
-// callbacks can always be created. Although this function is similiar to the darwin version it may act
-// differently.
+// callbacks can always be created. The returned function pointer is the C-callable address of fn and
+// stays valid for the lifetime of the process, so it can be stored and compared with the pointers that C hands back,
+// and there is no function to release it.
+// A Go value that C passes back to the callback as a void* must be passed as a Handle and not as a pointer.
+// Although this function is similiar to the darwin version it may act differently.
 func NewCallback(fn any) uintptr {
 	isCDecl := false
 	ty := reflect.TypeOf(fn)
@@ -41,6 +48,88 @@ func NewCallback(fn any) uintptr {
 	return syscall.NewCallback(fn)
 }
 
+// RTLD_DEFAULT is a pseudo-handle for RegisterLibFunc and RegisterLibFuncWeak to search
+// for the symbol in every module that is loaded into the process, like it does on the other platforms.
+const RTLD_DEFAULT = 0
+
+// errnoLocation is never called since RegisterFunc doesn't return errno on Windows.
+func errnoLocation() uintptr {
+	return 0
+}
+
 func loadSymbol(handle uintptr, name string) (uintptr, error) {
+	if handle == RTLD_DEFAULT {
+		return loadDefaultSymbol(name)
+	}
 	return syscall.GetProcAddress(syscall.Handle(handle), name)
 }
+
+var procEnumProcessModules = syscall.NewLazyDLL("kernel32.dll").NewProc("K32EnumProcessModules")
+
+// loadDefaultSymbol returns the first symbol called name in the modules loaded into the process.
+func loadDefaultSymbol(name string) (uintptr, error) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	modules := make([]syscall.Handle, 256)
+	for {
+		var needed uint32
+		size := uintptr(len(modules)) * unsafe.Sizeof(modules[0])
+		r, _, err := procEnumProcessModules.Call(uintptr(process), uintptr(unsafe.Pointer(&modules[0])), size, uintptr(unsafe.Pointer(&needed)))
+		if r == 0 {
+			return 0, err
+		}
+		n := int(uintptr(needed) / unsafe.Sizeof(modules[0]))
+		if n <= len(modules) {
+			modules = modules[:n]
+			break
+		}
+		// more modules are loaded than fit so try again with enough room
+		modules = make([]syscall.Handle, n)
+	}
+	for _, module := range modules {
+		if sym, err := syscall.GetProcAddress(module, name); err == nil {
+			return sym, nil
+		}
+	}
+	return 0, errors.New("purego: symbol " + name + " not found in any loaded module")
+}
+
+// loadSymbols reads the names of the export directory of the PE image that the module handle points to.
+func loadSymbols(handle uintptr) ([]string, error) {
+	if handle == RTLD_DEFAULT {
+		return nil, errors.New("purego: Symbols needs the handle of a module")
+	}
+	if readAt[uint16](handle) != 0x5a4d { // "MZ"
+		return nil, errors.New("purego: the module isn't a PE image")
+	}
+	nt := handle + uintptr(readAt[uint32](handle+0x3c))
+	if readAt[uint32](nt) != 0x4550 { // "PE\0\0"
+		return nil, errors.New("purego: the module isn't a PE image")
+	}
+	// the optional header follows the signature and the 20 bytes of IMAGE_FILE_HEADER
+	optional := nt + 24
+	var directories uintptr
+	switch readAt[uint16](optional) {
+	case 0x10b: // PE32
+		directories = optional + 96
+	case 0x20b: // PE32+
+		directories = optional + 112
+	default:
+		return nil, errors.New("purego: the module has an unknown optional header")
+	}
+	// IMAGE_DIRECTORY_ENTRY_EXPORT is the first data directory
+	exportRVA := readAt[uint32](directories)
+	if exportRVA == 0 {
+		return nil, nil
+	}
+	exports := handle + uintptr(exportRVA)
+	n := readAt[uint32](exports + 24)                     // NumberOfNames
+	names := handle + uintptr(readAt[uint32](exports+32)) // AddressOfNames
+	symbols := make([]string, 0, n)
+	for i := uintptr(0); i < uintptr(n); i++ {
+		symbols = append(symbols, strings.GoString(handle+uintptr(readAt[uint32](names+i*4))))
+	}
+	return symbols, nil
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+
+unsigned __int128 ReturnUint128(uint64_t lo, uint64_t hi) {
+    return ((unsigned __int128)hi << 64) | lo;
+}
+
+struct TwoWords {
+    uint64_t a, b;
+};
+
+struct TwoWords ReturnTwoWords(uint64_t a, uint64_t b) {
+    struct TwoWords w = {a, b};
+    return w;
+}
+
+struct FourWords {
+    int64_t a, b, c, d;
+};
+
+struct FourWords ReturnFourWords(int64_t a, int64_t b, int64_t c, int64_t d) {
+    struct FourWords w = {a, b, c, d};
+    return w;
+}
+
+// Sum14 and Sum15 weight each argument by its position so that misplaced arguments are noticed
+int64_t Sum14(int64_t a1, int64_t a2, int64_t a3, int64_t a4, int64_t a5, int64_t a6, int64_t a7, int64_t a8, int64_t a9, int64_t a10, int64_t a11, int64_t a12, int64_t a13, int64_t a14) {
+    return 1*a1 + 2*a2 + 3*a3 + 4*a4 + 5*a5 + 6*a6 + 7*a7 + 8*a8 + 9*a9 + 10*a10 + 11*a11 + 12*a12 + 13*a13 + 14*a14;
+}
+
+int64_t Sum15(int64_t a1, int64_t a2, int64_t a3, int64_t a4, int64_t a5, int64_t a6, int64_t a7, int64_t a8, int64_t a9, int64_t a10, int64_t a11, int64_t a12, int64_t a13, int64_t a14, int64_t a15) {
+    return 1*a1 + 2*a2 + 3*a3 + 4*a4 + 5*a5 + 6*a6 + 7*a7 + 8*a8 + 9*a9 + 10*a10 + 11*a11 + 12*a12 + 13*a13 + 14*a14 + 15*a15;
+}
+
+// BoolOnStack has more integer arguments than there are registers so that b is passed on the stack
+int64_t BoolOnStack(int64_t a1, int64_t a2, int64_t a3, int64_t a4, int64_t a5, int64_t a6, int64_t a7, int64_t a8, bool b, int64_t a10) {
+    int64_t sum = 1*a1 + 2*a2 + 3*a3 + 4*a4 + 5*a5 + 6*a6 + 7*a7 + 8*a8 + 10*a10;
+    return b ? -sum : sum;
+}
+
+// GetSize and SplitWords return their results through out-parameters
+bool GetSize(int32_t id, int32_t *w, int32_t *h) {
+    if (id < 0) {
+        return false;
+    }
+    *w = id * 2;
+    *h = id * 3;
+    return true;
+}
+
+void SplitWords(uint64_t x, uint32_t *lo, uint32_t *hi) {
+    *lo = (uint32_t)x;
+    *hi = (uint32_t)(x >> 32);
+}
+
+// GetNumbers returns the first n squares or NULL if n is negative
+const int32_t *GetNumbers(int32_t n, size_t *len) {
+    static const int32_t squares[] = {0, 1, 4, 9, 16, 25, 36, 49};
+    if (n < 0) {
+        return 0;
+    }
+    *len = n;
+    return squares;
+}
+
+// ArgvLength returns the number of strings in the NULL-terminated argv times 1000 plus their total length
+size_t ArgvLength(char *const argv[]) {
+    size_t n = 0;
+    for (; *argv != 0; argv++) {
+        n += 1000;
+        for (const char *c = *argv; *c != 0; c++) {
+            n++;
+        }
+    }
+    return n;
+}
+
+// GetWords returns a NULL-terminated array of strings
+const char *const *GetWords(void) {
+    static const char *const words[] = {"purego", "", "calls C", 0};
+    return words;
+}
+
+#if defined(__APPLE__)
+#define ASM_SYMBOL(name) "_" #name
+#else
+#define ASM_SYMBOL(name) #name
+#endif
+
+// AddWithCarry returns a + b and leaves the carry flag set if the addition overflowed.
+// It is written in assembly since C can't return anything in the flags.
+uint64_t AddWithCarry(uint64_t a, uint64_t b);
+__asm__(
+    ".text\n"
+    ".globl " ASM_SYMBOL(AddWithCarry) "\n"
+    ASM_SYMBOL(AddWithCarry) ":\n"
+#if defined(__x86_64__)
+    "    movq %rdi, %rax\n"
+    "    addq %rsi, %rax\n"
+#elif defined(__aarch64__)
+    "    adds x0, x0, x1\n"
+#endif
+    "    ret\n");
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <sys/types.h>
+#include <time.h>
+#include <wchar.h>
+
+#if defined(__x86_64__)
+#include <xmmintrin.h>
+#elif defined(__aarch64__)
+#include <arm_neon.h>
+#endif
+
+// Each Echo function returns its argument so that a conversion is checked both as an argument and as a return value.
+#define ECHO(name, type) \
+    type Echo##name(type x) { return x; }
+
+ECHO(Bool, bool)
+ECHO(Uint8, uint8_t)
+ECHO(Uint16, uint16_t)
+ECHO(Uint32, uint32_t)
+ECHO(Uint64, uint64_t)
+ECHO(Int8, int8_t)
+ECHO(Int16, int16_t)
+ECHO(Int32, int32_t)
+ECHO(Int64, int64_t)
+ECHO(Uintptr, uintptr_t)
+ECHO(Size, size_t)
+ECHO(SSize, ssize_t)
+ECHO(TimeT, time_t)
+ECHO(Float, float)
+ECHO(Double, double)
+ECHO(Pointer, void *)
+ECHO(String, const char *)
+ECHO(WString, const wchar_t *)
+
+// Each Widen function returns its argument as 64 bits so that the extension of a narrow argument is checked.
+// Apple's arm64 calling convention leaves it to the caller to extend them.
+#define WIDEN(name, type, wide) \
+    wide Widen##name(type x) { return x; }
+
+WIDEN(Bool, bool, uint64_t)
+WIDEN(Uint8, uint8_t, uint64_t)
+WIDEN(Uint16, uint16_t, uint64_t)
+WIDEN(Uint32, uint32_t, uint64_t)
+WIDEN(Int8, int8_t, int64_t)
+WIDEN(Int16, int16_t, int64_t)
+WIDEN(Int32, int32_t, int64_t)
+
+// Each Narrow function returns the low bits of its argument. The compiler is free to leave the high bits
+// of the return register as they were so this checks that only the low bits of a narrow return value are read.
+#define NARROW(name, type) \
+    type Narrow##name(uint64_t x) { return (type)x; }
+
+NARROW(Uint8, uint8_t)
+NARROW(Uint16, uint16_t)
+NARROW(Uint32, uint32_t)
+NARROW(Int8, int8_t)
+NARROW(Int16, int16_t)
+NARROW(Int32, int32_t)
+
+enum Color {
+    ColorNone = -1,
+    ColorRed,
+    ColorGreen,
+    ColorBlue,
+};
+
+enum Color NextColor(enum Color c) {
+    return c == ColorBlue ? ColorNone : c + 1;
+}
+
+int64_t SumInt32s(const int32_t *p, size_t n) {
+    int64_t sum = 0;
+    for (size_t i = 0; i < n; i++) {
+        sum += p[i];
+    }
+    return sum;
+}
+
+// the float arguments around the array check that its pointer and length are integer arguments
+double ScaleFloats(double scale, const float *p, size_t n, float bias) {
+    double sum = 0;
+    for (size_t i = 0; i < n; i++) {
+        sum += p[i];
+    }
+    return sum * scale + bias;
+}
+
+double SumDoubles(const double *p, size_t n) {
+    double sum = 0;
+    for (size_t i = 0; i < n; i++) {
+        sum += p[i];
+    }
+    return sum;
+}
+
+const char *StringAt(char *const *argv, size_t i) {
+    return argv[i];
+}
+
+struct Pair {
+    int64_t a;
+    double b;
+};
+
+struct Pair EchoPair(struct Pair p) {
+    return p;
+}
+
+// NewPair returns a Pair or NULL if ok is false like a factory function that fails.
+struct Pair *NewPair(bool ok) {
+    static struct Pair p = {1, 2.5};
+    return ok ? &p : 0;
+}
+
+typedef int64_t (*BinaryOp)(int64_t, int64_t);
+
+static int64_t subtract(int64_t a, int64_t b) {
+    return a - b;
+}
+
+BinaryOp GetSubtract(void) {
+    return subtract;
+}
+
+int64_t Apply(BinaryOp op, int64_t a, int64_t b) {
+    return op(a, b);
+}
+
+bool IsSubtract(BinaryOp op) {
+    return op == subtract;
+}
+
+static int value = 42;
+
+// CallKinds calls cb with an argument of each kind that a callback can take and returns what cb returns.
+int64_t CallKinds(int64_t (*cb)(bool, int8_t, uint16_t, int32_t, uint64_t, float, double, void *)) {
+    return cb(true, -8, 16, -32, 64, 1.5f, 2.25, &value);
+}
+
+int *ValuePointer(void) {
+    return &value;
+}
+
+struct Doubles {
+    double a, b;
+};
+
+struct Floats {
+    float a, b;
+};
+
+// the members are returned in the first two float registers
+struct Doubles SplitDouble(double x) {
+    struct Doubles d = {x * 2, -x};
+    return d;
+}
+
+struct Floats SplitFloat(float x) {
+    struct Floats f = {x * 2, -x};
+    return f;
+}
+
+// the whole vector is returned in XMM0 or V0
+#if defined(__x86_64__)
+__m128 AddVectors(const float *a, const float *b) {
+    return _mm_add_ps(_mm_loadu_ps(a), _mm_loadu_ps(b));
+}
+#elif defined(__aarch64__)
+float32x4_t AddVectors(const float *a, const float *b) {
+    return vaddq_f32(vld1q_f32(a), vld1q_f32(b));
+}
+#endif
@@ -1,6 +1,8 @@
 // SPDX-License-Identifier: Apache-2.0
 // SPDX-FileCopyrightText: 2023 The Ebitengine Authors
 
+#include <pthread.h>
+#include <stdlib.h>
 #include <string.h>
 
 typedef int (*callback)(const char *, int);
@@ -11,3 +13,136 @@ int callCallback(const void *fp, const char *s) {
     ((callback)(fp))(s, strlen(s));
     return sentinel;
 }
+
+struct node {
+    int value;
+    const struct node *left, *right;
+};
+
+static const struct node leaves[4] = {{4, 0, 0}, {5, 0, 0}, {6, 0, 0}, {7, 0, 0}};
+static const struct node branches[2] = {{2, &leaves[0], &leaves[1]}, {3, &leaves[2], &leaves[3]}};
+static const struct node root = {1, &branches[0], &branches[1]};
+
+const struct node *getTree(void) {
+    return &root;
+}
+
+typedef int (*visitor)(const struct node *, int, double);
+
+int walkTree(const void *fp, const struct node *n, int depth, double scale) {
+    if (n == 0) {
+        return 0;
+    }
+    // If a nested callback clobbers this frame, this local variable on the stack will have incorrect value.
+    int sentinel = 10101 + depth;
+    int result = ((visitor)(fp))(n, depth, scale);
+    if (sentinel != 10101 + depth) {
+        return -1;
+    }
+    return result;
+}
+
+struct operations {
+    int (*add)(int, int);
+    int (*mul)(int, int);
+    int (*neg)(int);
+};
+
+int applyOperations(const struct operations *ops, int a, int b) {
+    int result = ops->mul(ops->add(a, b), b);
+    if (ops->neg != 0) {
+        result = ops->neg(result);
+    }
+    return result;
+}
+
+typedef void (*valueVisitor)(void *, int);
+
+void forEachValue(const int *values, int n, valueVisitor fn, void *ctx) {
+    for (int i = 0; i < n; i++) {
+        fn(ctx, values[i]);
+    }
+}
+
+struct counter {
+    int value;
+};
+
+static int freed;
+
+struct counter *newCounter(int start) {
+    if (start < 0) {
+        return 0;
+    }
+    struct counter *c = malloc(sizeof(struct counter));
+    c->value = start;
+    return c;
+}
+
+int counterValue(const struct counter *c) {
+    return c->value;
+}
+
+void freeCounter(struct counter *c) {
+    free(c);
+    __atomic_add_fetch(&freed, 1, __ATOMIC_SEQ_CST);
+}
+
+int freedCounters(void) {
+    return __atomic_load_n(&freed, __ATOMIC_SEQ_CST);
+}
+
+// deepCall recurses depth times and checks that no frame was clobbered, for example by the handler of a signal.
+// It returns depth + 1 or -1 if a frame was clobbered. If cb isn't NULL it is called by the deepest frame.
+int deepCall(int depth, int (*cb)(int)) {
+    volatile int frame[16];
+    for (int i = 0; i < 16; i++) {
+        frame[i] = depth * 16 + i;
+    }
+    int result = depth > 0 ? deepCall(depth - 1, cb) : (cb != 0 ? cb(depth) : 0);
+    for (int i = 0; i < 16; i++) {
+        if (frame[i] != depth * 16 + i) {
+            return -1;
+        }
+    }
+    return result < 0 ? result : result + 1;
+}
+
+struct notification {
+    void (*fn)(int);
+    int n;
+};
+
+static void *notify(void *arg) {
+    struct notification *notification = arg;
+    for (int i = 0; i < notification->n; i++) {
+        notification->fn(i);
+    }
+    free(notification);
+    return 0;
+}
+
+// notifyAsync calls fn with 0 to n-1 from a new thread and returns 0 or -1 if the thread couldn't be created.
+int notifyAsync(void (*fn)(int), int n) {
+    struct notification *notification = malloc(sizeof(struct notification));
+    notification->fn = fn;
+    notification->n = n;
+    pthread_t thread;
+    if (pthread_create(&thread, 0, notify, notification) != 0) {
+        free(notification);
+        return -1;
+    }
+    pthread_detach(thread);
+    return 0;
+}
+
+typedef int (*handler)(int);
+
+// dispatch calls each of the n handlers with event and returns the sum of what they return
+int dispatch(const handler *handlers, int n, int event) {
+    int sum = 0;
+    for (int i = 0; i < n; i++) {
+        sum += handlers[i](event);
+    }
+    return sum;
+}
@@ -309,6 +309,17 @@ _Bool BoolStruct(struct BoolStruct b) {
     return b.b;
 }
 
+struct CharBool {
+    char c;
+    _Bool b;
+};
+
+int CharBool(struct CharBool s) {
+    if (s.b)
+        return s.c;
+    return -s.c;
+}
+
 struct BoolFloat {
     _Bool b;
     float f;
@@ -333,6 +344,87 @@ unsigned long InitWithContentRect(int *win, struct Content c, int style, int bac
   return (unsigned long)(c.point.x + c.point.y + c.size.width + c.size.height) / (style - backing);
 }
 
+struct TaggedPoint {
+    struct { float x, y; } point;
+    int32_t tag;
+};
+
+int32_t TaggedPoint(struct TaggedPoint t) {
+    return (int32_t)(t.point.x * t.point.y) + t.tag;
+}
+
+struct TwoPoints {
+    struct { double x, y; } a, b;
+};
+
+// TwoPoints is an HFA with four members so it doesn't fit in the remaining two float registers
+double TwoPoints(double a, double b, double c, double d, double e, double f, struct TwoPoints p) {
+    return a + b + c + d + e + f + p.a.x + p.a.y + p.b.x + p.b.y;
+}
+
+struct ByteSlice {
+    const char *data;
+    GoInt len;
+};
+
+// ByteSlice counts the number of 'a' in the slice
+GoInt ByteSlice(struct ByteSlice s) {
+    GoInt n = 0;
+    for (GoInt i = 0; i < s.len; i++) {
+        if (s.data[i] == 'a')
+            n++;
+    }
+    return n;
+}
+
+struct Opaque12 {
+    unsigned char data[12];
+};
+
+// Opaque12 returns the sum of every byte multiplied by its position
+GoInt Opaque12(struct Opaque12 o) {
+    GoInt n = 0;
+    for (GoInt i = 0; i < 12; i++) {
+        n += o.data[i] * (i + 1);
+    }
+    return n;
+}
+
+struct Opaque24 {
+    unsigned char data[24];
+};
+
+// Opaque24 returns the sum of every byte multiplied by its position
+GoInt Opaque24(struct Opaque24 o) {
+    GoInt n = 0;
+    for (GoInt i = 0; i < 24; i++) {
+        n += o.data[i] * (i + 1);
+    }
+    return n;
+}
+
+struct Mixed32 {
+    int64_t a;
+    double b;
+    int32_t c;
+    float d;
+    int64_t e;
+};
+
+// Mixed32 isn't an HFA and is larger than 16 bytes so it is passed as a pointer to a copy on arm64
+double Mixed32(struct Mixed32 m) {
+    return m.a + 2 * m.b + 3 * m.c + 4 * m.d + 5 * m.e;
+}
+
+struct FourFloats {
+    float a, b, c, d;
+};
+
+// FourFloatsAfterRegs leaves two float registers so the HFA FourFloats is passed on the stack on arm64
+float FourFloatsAfterRegs(double a1, double a2, double a3, double a4, double a5, double a6, struct FourFloats f) {
+    return (float)(a1 + a2 + a3 + a4 + a5 + a6) + f.a + 2 * f.b + 3 * f.c + 4 * f.d;
+}
+
 struct GoInt4 {
     GoInt a, b, c, d;
 };
@@ -348,3 +440,96 @@ struct GoUint4 {
 GoUint GoUint4(struct GoUint4 g) {
     return g.a + g.b + g.c + g.d;
 }
+
+struct FloatsInt64 {
+    float a, b;
+    int64_t c;
+};
+
+// the first eightbyte of FloatsInt64 is SSE and the second is INTEGER on amd64
+double FloatsInt64(struct FloatsInt64 f) {
+    return f.a + 2 * f.b + 3 * f.c;
+}
+
+struct FloatInt32Double {
+    float a;
+    int32_t b;
+    double c;
+};
+
+// the first eightbyte of FloatInt32Double is INTEGER since it has an integer and the second is SSE on amd64
+double FloatInt32Double(struct FloatInt32Double f) {
+    return f.a + 2 * f.b + 3 * f.c;
+}
+
+struct TwoInt64 {
+    int64_t a, b;
+};
+
+// TwoInt64AfterInts leaves one integer register which isn't enough for TwoInt64 on amd64,
+// so the struct is passed on the stack and a6 in the last register
+int64_t TwoInt64AfterInts(int64_t a1, int64_t a2, int64_t a3, int64_t a4, int64_t a5, struct TwoInt64 s, int64_t a6) {
+    return a1 + 2 * a2 + 3 * a3 + 4 * a4 + 5 * a5 + 6 * s.a + 7 * s.b + 8 * a6;
+}
+
+struct Big {
+    int64_t a[6];
+    double b[3];
+};
+
+// Big is larger than 64 bytes so it is passed in memory on the stack on amd64 and as a pointer to a copy on arm64,
+// while the arguments around it still take the next registers
+double BigStruct(int64_t a1, struct Big s, double f1, int64_t a2) {
+    double sum = a1 + 2 * f1 + 3 * a2;
+    for (int i = 0; i < 6; i++) {
+        sum += (i + 4) * s.a[i];
+    }
+    for (int i = 0; i < 3; i++) {
+        sum += (i + 10) * s.b[i];
+    }
+    return sum;
+}
+
+struct Handle {
+    int64_t *p;
+};
+
+// a struct with only a pointer is passed in an integer register like the pointer
+int64_t DerefHandle(struct Handle h) {
+    return *h.p;
+}
+
+struct Buffer {
+    const int64_t *data;
+    int32_t len;
+};
+
+// Buffer is passed in two integer registers on amd64 and arm64
+int64_t SumBuffer(struct Buffer b) {
+    int64_t sum = 0;
+    for (int32_t i = 0; i < b.len; i++) {
+        sum += b.data[i];
+    }
+    return sum;
+}
+
+// SumBufferAfterInts leaves one integer register which isn't enough for Buffer on amd64,
+// so the struct is passed on the stack and a6 in the last register
+int64_t SumBufferAfterInts(int64_t a1, int64_t a2, int64_t a3, int64_t a4, int64_t a5, struct Buffer b, int64_t a6) {
+    return a1 + a2 + a3 + a4 + a5 + SumBuffer(b) + a6;
+}
+
+struct GUID {
+    uint32_t Data1;
+    uint16_t Data2, Data3;
+    uint8_t Data4[8];
+};
+
+// a GUID is passed in two integer registers on amd64 and arm64 and the float arguments around it don't change that
+uint64_t GUIDSum(double f1, struct GUID g, float f2) {
+    uint64_t sum = g.Data1 + g.Data2 + g.Data3 + (uint64_t)f1 + (uint64_t)f2;
+    for (int i = 0; i < 8; i++) {
+        sum += (uint64_t)g.Data4[i] << i;
+    }
+    return sum;
+}
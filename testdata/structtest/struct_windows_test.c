@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+#include <stdint.h>
+
+#define EXPORT __declspec(dllexport)
+
+// structs of 1, 2, 4 or 8 bytes are passed in a single integer register or slot
+struct Bytes1 {
+    uint8_t a;
+};
+
+struct Bytes2 {
+    uint8_t a, b;
+};
+
+struct Float4 {
+    float a;
+};
+
+struct IntFloat8 {
+    int32_t a;
+    float b;
+};
+
+EXPORT int64_t Bytes1(struct Bytes1 s) {
+    return s.a;
+}
+
+EXPORT int64_t Bytes2(struct Bytes2 s) {
+    return s.a + 2 * s.b;
+}
+
+EXPORT int64_t Float4(struct Float4 s) {
+    return (int64_t)(s.a * 10);
+}
+
+EXPORT int64_t IntFloat8(struct IntFloat8 s) {
+    return s.a + (int64_t)(s.b * 10);
+}
+
+// any other struct is passed as a pointer to a copy that the callee may modify
+struct Bytes3 {
+    uint8_t a, b, c;
+};
+
+struct Int12 {
+    int32_t a, b, c;
+};
+
+struct Double16 {
+    double a, b;
+};
+
+EXPORT int64_t Bytes3(struct Bytes3 s) {
+    int64_t sum = s.a + 2 * s.b + 3 * s.c;
+    s.a = 0xff;
+    return sum;
+}
+
+EXPORT int64_t Int12(struct Int12 s) {
+    int64_t sum = s.a + 2 * s.b + 3 * s.c;
+    s.a = -1;
+    return sum;
+}
+
+EXPORT int64_t Double16(struct Double16 s) {
+    int64_t sum = (int64_t)(s.a * 10 + s.b * 100);
+    s.a = -1;
+    return sum;
+}
+
+// the first 4 arguments are in registers so s is in the 5th slot on the stack
+// and r is a pointer to a copy in the 6th slot
+EXPORT int64_t StructsOnStack(int64_t a1, double a2, int64_t a3, int64_t a4, struct IntFloat8 s, struct Int12 r, int64_t a7) {
+    return a1 + (int64_t)(a2 * 10) + a3 + a4 + s.a + (int64_t)(s.b * 10) + r.a + r.b + r.c + a7;
+}
@@ -88,6 +88,15 @@ struct ThreeFloats ReturnThreeFloats(float a, float b, float c) {
     return e;
 }
 
+struct Quaternion{
+    float x, y, z, w;
+};
+
+struct Quaternion ReturnQuaternion(float x, float y, float z, float w) {
+    struct Quaternion e = {x, y, z, w};
+    return e;
+}
+
 struct OneFloat ReturnOneFloat(float a) {
     struct OneFloat e = {a};
     return e;
@@ -236,3 +245,39 @@ struct Ptr1 ReturnPtr1(int64_t *a, void *b) {
     struct Ptr1 s = {a, b};
     return s;
 }
+
+struct FloatsInt64 {
+    float a, b;
+    int64_t c;
+};
+
+struct FloatsInt64 ReturnFloatsInt64(float a, float b, int64_t c) {
+    struct FloatsInt64 s = {a, b, c};
+    return s;
+}
+
+struct FloatInt32Double {
+    float a;
+    int32_t b;
+    double c;
+};
+
+struct FloatInt32Double ReturnFloatInt32Double(float a, int32_t b, double c) {
+    struct FloatInt32Double s = {a, b, c};
+    return s;
+}
+
+struct Large128 {
+    int64_t a[8];
+    double b[8];
+};
+
+// Large128 is written to the memory that the hidden pointer in RDI on amd64 or X8 on arm64 points to
+struct Large128 ReturnLarge128(int64_t start, double scale) {
+    struct Large128 s;
+    for (int i = 0; i < 8; i++) {
+        s.a[i] = start + i;
+        s.b[i] = scale * i;
+    }
+    return s;
+}
@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+// TimeT is the Go type of the C time_t. It is 64 bits on every architecture, which is the time_t of musl 1.2
+// and later and of glibc when it is built with _TIME_BITS=64 on a 32-bit platform. Without _TIME_BITS=64,
+// glibc's time_t is 32 bits on a 32-bit platform and purego can't detect which one a library was built with,
+// so functions that take that time_t must be declared with an int32 instead.
+type TimeT = int64
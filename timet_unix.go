@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd
+
+package purego
+
+// TimeT is the Go type of the C time_t. It has the size of a pointer like the time_t of macOS and of FreeBSD except on 32-bit arm and powerpc.
+type TimeT = int
@@ -0,0 +1,8 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+// TimeT is the Go type of the C time_t. It is 64 bits on every architecture since the UCRT and MSVC
+// use a 64-bit time_t unless _USE_32BIT_TIME_T is defined. Functions built with it, like _time32, take an int32.
+type TimeT = int64
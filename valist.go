@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"math"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// VaList creates a C va_list that contains args, so that functions like vsnprintf that take
+// a va_list can be called. The result is passed to the C function as its va_list argument:
+//
+//	// int vsnprintf(char *str, size_t size, const char *format, va_list ap);
+//	var vsnprintf func(str *byte, size purego.Size, format string, ap unsafe.Pointer) int32
+//	ap, release := purego.VaList(int32(1), "one")
+//	defer release()
+//	vsnprintf(&buf[0], purego.Size(len(buf)), "%d %s\x00", ap)
+//
+// The arguments are converted like the arguments of a C variadic function: integers, bools and pointers
+// are passed as an integer, float32 is promoted to a double and strings are copied into null-terminated
+// strings. The va_list and the strings are in C memory that stays valid until release is called. Memory that
+// a pointer argument points to must be kept alive by the caller as long as the va_list is used.
+// A va_list is consumed by the function it's passed to, so create a new one for every call.
+//
+// VaList panics on 32-bit platforms.
+func VaList(args ...any) (ap unsafe.Pointer, release func()) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		panic("purego: VaList is only supported on 64-bit platforms")
+	}
+	// The va_list is made of a header that is specific to the calling convention
+	// followed by the arguments in 8-byte slots and the memory of the strings.
+	// It's a single allocation so that release only has to free one pointer.
+	var header int
+	switch {
+	case runtime.GOARCH == "amd64" && runtime.GOOS != "windows":
+		// struct { unsigned gp_offset, fp_offset; void *overflow_arg_area, *reg_save_area; }
+		header = 3
+	case runtime.GOARCH == "arm64" && runtime.GOOS != "darwin" && runtime.GOOS != "windows":
+		// struct { void *__stack, *__gr_top, *__vr_top; int __gr_offs, __vr_offs; }
+		header = 4
+	default:
+		// va_list is a char* pointing to the arguments
+	}
+	size := header + len(args)
+	for _, arg := range args {
+		switch v := reflect.ValueOf(arg); v.Kind() {
+		case reflect.String:
+			size += (v.Len() + 1 + 7) / 8
+		case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Bool, reflect.Ptr, reflect.UnsafePointer, reflect.Float32, reflect.Float64:
+		default:
+			panic("purego: unsupported kind: " + v.Kind().String())
+		}
+	}
+	if size == 0 {
+		return nil, func() {}
+	}
+	ap = cMalloc(uintptr(size) * 8)
+	buf := unsafe.Slice((*uintptr)(ap), size)
+	for i := range buf {
+		buf[i] = 0
+	}
+	slots := buf[header : header+len(args)]
+	data := buf[header+len(args):]
+	for i, arg := range args {
+		v := reflect.ValueOf(arg)
+		switch v.Kind() {
+		case reflect.String:
+			s := v.String()
+			copy(unsafe.Slice((*byte)(unsafe.Pointer(&data[0])), len(data)*8), s)
+			slots[i] = uintptr(unsafe.Pointer(&data[0]))
+			data = data[(len(s)+1+7)/8:]
+		case reflect.Uintptr, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			slots[i] = uintptr(v.Uint())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			slots[i] = uintptr(v.Int())
+		case reflect.Bool:
+			if v.Bool() {
+				slots[i] = 1
+			}
+		case reflect.Ptr, reflect.UnsafePointer:
+			slots[i] = v.Pointer()
+		case reflect.Float32, reflect.Float64:
+			slots[i] = uintptr(math.Float64bits(v.Float()))
+		}
+	}
+	switch header {
+	case 3:
+		// gp_offset and fp_offset are past the end of the register save area
+		// so that va_arg reads every argument from overflow_arg_area.
+		const gpOffset, fpOffset = 6 * 8, 6*8 + 8*16
+		offsets := uint64(gpOffset | fpOffset<<32) // not a constant since it overflows uintptr on 32-bit platforms
+		buf[0] = uintptr(offsets)
+		buf[1] = uintptr(ap) + uintptr(header)*8
+	case 4:
+		// __gr_offs and __vr_offs are zero so that va_arg reads every argument from __stack.
+		buf[0] = uintptr(ap) + uintptr(header)*8
+	}
+	return ap, func() { cFree(ap) }
+}
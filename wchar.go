@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux || windows
+
+package purego
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// WString is a string that is passed to and returned from C functions as a null-terminated wchar_t*
+// instead of a char*. When it is an argument, the string is converted to a temporary wchar_t* that is
+// only valid for the duration of the call. When it is a return value, the wchar_t* is copied to a Go string.
+type WString string
+
+var wstringType = reflect.TypeOf(WString(""))
+
+// WCharPtr converts s to a null-terminated wchar_t* that can be passed to C code.
+// wchar_t is UTF-16 on Windows and UTF-32 on all other platforms.
+func WCharPtr(s string) *WChar {
+	w := append(encodeWChars(s), 0)
+	return &w[0]
+}
+
+// GoWString copies a null-terminated wchar_t* to a Go string.
+func GoWString(p *WChar) string {
+	if p == nil {
+		return ""
+	}
+	var length int
+	for *(*WChar)(unsafe.Add(unsafe.Pointer(p), uintptr(length)*unsafe.Sizeof(WChar(0)))) != 0 {
+		length++
+	}
+	return decodeWChars(unsafe.Slice(p, length))
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+//go:build darwin || freebsd || linux
+
+package purego
+
+// WChar is a C wchar_t which is a UTF-32 code point on all platforms except Windows.
+type WChar = int32
+
+func encodeWChars(s string) []WChar {
+	return []rune(s)
+}
+
+func decodeWChars(w []WChar) string {
+	return string(w)
+}
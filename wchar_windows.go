@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: 2024 The Ebitengine Authors
+
+package purego
+
+import "unicode/utf16"
+
+// WChar is a C wchar_t which is a UTF-16 code unit on Windows.
+type WChar = uint16
+
+func encodeWChars(s string) []WChar {
+	return utf16.Encode([]rune(s))
+}
+
+func decodeWChars(w []WChar) string {
+	return string(utf16.Decode(w))
+}